@@ -0,0 +1,119 @@
+package tokenizer
+
+// BracketPair is a pair of keys of open and close tokens, like `(` and `)`.
+type BracketPair struct {
+	Open  TokenKey
+	Close TokenKey
+}
+
+// SkipBalanced moves the pointer from the open token to the token after the matching close token.
+// The current token must be an open token of one of the pairs: (openKey, closeKey) or `pairs`.
+// Nested pairs must be balanced too, strings are single tokens and injections into strings are skipped as a whole.
+//
+//	stream.SkipBalanced(TCurlyOpen, TCurlyClose, tokenizer.BracketPair{TSquareOpen, TSquareClose})
+//
+// If the current token is not an open token, the close token doesn't match the open one or the stream ends
+// before the close token, the method returns *SyntaxError and the pointer stays at the unexpected token.
+func (s *Stream) SkipBalanced(openKey, closeKey TokenKey, pairs ...BracketPair) error {
+	if err := s.findBalanced(append([]BracketPair{{openKey, closeKey}}, pairs...)); err != nil {
+		return err
+	}
+	s.GoNext()
+	return nil
+}
+
+// SubStream returns the view over tokens between the open token and the matching close token, see SkipBalanced.
+// The pointer of the stream is moved to the token after the close token.
+// The view shares tokens with the stream: the stream keeps tokens of the view in the history (see SetHistorySize)
+// until the view is closed. The view becomes invalid after the stream is closed.
+//
+//	args, err := stream.SubStream(TParenOpen, TParenClose)
+//	if err != nil {
+//		return err
+//	}
+//	defer args.Close()
+func (s *Stream) SubStream(openKey, closeKey TokenKey, pairs ...BracketPair) (*Stream, error) {
+	mark := s.Mark()
+	if err := s.findBalanced(append([]BracketPair{{openKey, closeKey}}, pairs...)); err != nil {
+		s.Release(mark)
+		return nil, err
+	}
+	first, last := mark.current, s.current
+	view := &Stream{
+		t:          s.t,
+		head:       undefToken,
+		current:    undefToken,
+		parent:     s,
+		parentMark: mark,
+		lower:      first,
+		upper:      last,
+		channels:   s.channels,
+	}
+	if first.next != last {
+		view.head, view.current = first.next, first.next
+		for token := first.next; token != last; token = token.next {
+			view.len++
+		}
+		view.skipHidden()
+	}
+	s.GoNext()
+	return view, nil
+}
+
+// findBalanced moves the pointer from the open token to the matching close token.
+func (s *Stream) findBalanced(pairs []BracketPair) error {
+	var closes []TokenKey
+	for _, pair := range pairs {
+		if s.current.Is(pair.Open) && s.IsValid() {
+			closes = append(closes, pair.Close)
+			break
+		}
+	}
+	if closes == nil {
+		opens := make([]TokenKey, len(pairs))
+		for i, pair := range pairs {
+			opens[i] = pair.Open
+		}
+		return s.syntaxError(opens, "")
+	}
+	for len(closes) > 0 {
+		if !s.GoNext().IsValid() {
+			break
+		}
+		if s.current.flags&flagInjectionStart != 0 {
+			s.skipInjection()
+			continue
+		}
+		if s.current.key == closes[len(closes)-1] {
+			closes = closes[:len(closes)-1]
+			continue
+		}
+		for _, pair := range pairs {
+			if s.current.key == pair.Open {
+				closes = append(closes, pair.Close)
+				break
+			} else if s.current.key == pair.Close {
+				return s.syntaxError(closes[len(closes)-1:], "")
+			}
+		}
+	}
+	if len(closes) > 0 {
+		return s.syntaxError(closes[len(closes)-1:], "")
+	}
+	return nil
+}
+
+// skipInjection moves the pointer from the start token of the injection into a string to the end token of the injection.
+func (s *Stream) skipInjection() {
+	for depth := 0; s.IsValid(); s.GoNext() {
+		if s.current.flags&flagInjectionStart != 0 {
+			depth++
+		}
+		if s.current.flags&flagInjectionEnd != 0 {
+			depth--
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipBalanced(t *testing.T) {
+	curlyOpen := TokenKey(10)
+	curlyClose := TokenKey(11)
+	squareOpen := TokenKey(12)
+	squareClose := TokenKey(13)
+	parenOpen := TokenKey(14)
+	parenClose := TokenKey(15)
+	dollarOpen := TokenKey(16)
+	quoteKey := TokenKey(17)
+	tokenizer := New()
+	tokenizer.DefineTokens(curlyOpen, []string{"{"})
+	tokenizer.DefineTokens(curlyClose, []string{"}"})
+	tokenizer.DefineTokens(squareOpen, []string{"["})
+	tokenizer.DefineTokens(squareClose, []string{"]"})
+	tokenizer.DefineTokens(parenOpen, []string{"("})
+	tokenizer.DefineTokens(parenClose, []string{")"})
+	tokenizer.DefineTokens(dollarOpen, []string{"${"})
+	tokenizer.DefineStringToken(quoteKey, `"`, `"`).AddInjection(dollarOpen, curlyClose)
+	square := BracketPair{squareOpen, squareClose}
+	paren := BracketPair{parenOpen, parenClose}
+
+	t.Run("skip", func(t *testing.T) {
+		stream := tokenizer.ParseString(`{ a [ b ( c ) ] "}" "x ${ { y } } ${ "${z}" } z" } end`)
+		require.NoError(t, stream.SkipBalanced(curlyOpen, curlyClose, square, paren))
+		require.Equal(t, "end", stream.CurrentToken().ValueString())
+
+		stream = tokenizer.ParseString(`[ a ] end`)
+		require.NoError(t, stream.SkipBalanced(curlyOpen, curlyClose, square))
+		require.Equal(t, "end", stream.CurrentToken().ValueString())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		stream := tokenizer.ParseString("{ a ( b ] }")
+		err := stream.SkipBalanced(curlyOpen, curlyClose, square, paren)
+		var syntaxErr *SyntaxError
+		require.True(t, errors.As(err, &syntaxErr))
+		require.EqualError(t, err, `1:9: syntax error: unexpected TokenKey(13) "]", expected TokenKey(15)`)
+		require.Equal(t, squareClose, stream.CurrentToken().Key())
+
+		stream = tokenizer.ParseString("{ a [ b ]")
+		err = stream.SkipBalanced(curlyOpen, curlyClose, square)
+		require.EqualError(t, err, `1:10: syntax error: unexpected end of stream, expected TokenKey(11)`)
+		require.False(t, stream.IsValid())
+
+		stream = tokenizer.ParseString("a { b }")
+		err = stream.SkipBalanced(curlyOpen, curlyClose, square)
+		require.EqualError(t, err, `1:1: syntax error: unexpected TokenKeyword "a", expected TokenKey(10) or TokenKey(12)`)
+		require.Equal(t, 0, stream.CurrentToken().ID())
+
+		stream = tokenizer.ParseString(`{ "a ${ b`)
+		err = stream.SkipBalanced(curlyOpen, curlyClose)
+		require.EqualError(t, err, `1:10: syntax error: unexpected end of stream, expected TokenKey(11)`)
+	})
+
+	t.Run("sub stream", func(t *testing.T) {
+		stream := tokenizer.ParseString("f(a, (b), c) d")
+		stream.GoNext()
+		args, err := stream.SubStream(parenOpen, parenClose)
+		require.NoError(t, err)
+		require.Equal(t, "d", stream.CurrentToken().ValueString())
+		require.Equal(t, []string{"a", ",", "(", "b", ")", ",", "c"}, streamValues(args))
+		require.Equal(t, TokenUndef, args.PeekKey(1))
+
+		args.GoTo(4)
+		inner, err := args.SubStream(parenOpen, parenClose)
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, streamValues(inner))
+		require.Equal(t, ",", args.CurrentToken().ValueString())
+		inner.GoTo(5).GoPrev()
+		require.False(t, inner.IsValid())
+		require.Equal(t, TokenUndef, inner.PrevToken().Key())
+		inner.Close()
+		require.Equal(t, "a", args.Peek(-5).ValueString())
+		require.Equal(t, TokenUndef, args.Peek(-6).Key())
+		require.Equal(t, "c", args.Peek(1).ValueString())
+		require.Equal(t, TokenUndef, args.Peek(2).Key())
+		args.Close()
+		require.Equal(t, "d", stream.CurrentToken().ValueString())
+		require.Equal(t, ")", stream.PrevToken().ValueString())
+
+		empty, err := tokenizer.ParseString("() x").SubStream(parenOpen, parenClose)
+		require.NoError(t, err)
+		require.False(t, empty.IsValid())
+		require.Empty(t, streamValues(empty))
+		empty.Close()
+
+		_, err = tokenizer.ParseString("(a").SubStream(parenOpen, parenClose)
+		require.Error(t, err)
+	})
+
+	t.Run("pinned history", func(t *testing.T) {
+		var source strings.Builder
+		source.WriteString("(")
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&source, "%d ", i)
+		}
+		source.WriteString(")")
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&source, " %d", i)
+		}
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 16).SetHistorySize(2)
+		view, err := stream.SubStream(parenOpen, parenClose)
+		require.NoError(t, err)
+		stream.GoTo(150)
+		require.Equal(t, 0, stream.HeadToken().ID())
+		require.Equal(t, 100, view.len)
+		require.Equal(t, int64(99), view.GoTo(100).CurrentToken().ValueInt64())
+		view.Close()
+		stream.GoNext()
+		require.Equal(t, 149, stream.HeadToken().ID())
+	})
+}
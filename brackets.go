@@ -0,0 +1,160 @@
+package tokenizer
+
+import "fmt"
+
+// DefineBrackets declares tokens of keys `open` and `close` as a pair of brackets.
+// The parser links each open token to its close token (see Token.Pair) and sets the nesting depth of tokens (see Token.Depth).
+// Unbalanced brackets are reported as diagnostics of the stream, see Stream.Diagnostics.
+//
+//	parser.DefineTokens(TParenOpen, []string{"("}).DefineTokens(TParenClose, []string{")"})
+//	parser.DefineBrackets(TParenOpen, TParenClose)
+//
+// Defining brackets for the same open key again replaces the pair or the ignored definition.
+func (t *Tokenizer) DefineBrackets(open, close TokenKey) *Tokenizer {
+	t.mutable()
+	if open < 1 || close < 1 || open == close {
+		t.reject("DefineBrackets", Problem{
+			Level:   ProblemError,
+			Key:     open,
+			Message: fmt.Sprintf("brackets %s and %s are ignored: keys must be positive and different", t.KeyName(open), t.KeyName(close)),
+		})
+		return t
+	}
+	t.retract("DefineBrackets", open)
+	for i, pair := range t.brackets {
+		if pair.Open == open {
+			t.brackets[i].Close = close
+			return t
+		}
+	}
+	t.brackets = append(t.brackets, BracketPair{Open: open, Close: close})
+	return t
+}
+
+// Brackets returns pairs of brackets in order of definition, see DefineBrackets.
+func (t *Tokenizer) Brackets() []BracketPair {
+	return append([]BracketPair(nil), t.brackets...)
+}
+
+// isOpenBracket checks if the key is the open key of any pair of brackets.
+func (t *Tokenizer) isOpenBracket(key TokenKey) bool {
+	for _, pair := range t.brackets {
+		if pair.Open == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isCloseBracket checks if the key is the close key of any pair of brackets.
+func (t *Tokenizer) isCloseBracket(key TokenKey) bool {
+	for _, pair := range t.brackets {
+		if pair.Close == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tokenizer) validateBrackets() []Problem {
+	var problems []Problem
+	for _, pair := range t.brackets {
+		for _, key := range []TokenKey{pair.Open, pair.Close} {
+			if len(t.tokens[key]) == 0 {
+				problems = append(problems, Problem{
+					Level:   ProblemError,
+					Key:     key,
+					Message: fmt.Sprintf("bracket key %s is not defined", t.KeyName(key)),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// bracketFrame is the open token which waits for the close token.
+// Properties of the token are copied because the token may be consumed (and changed) by the stream in async mode.
+type bracketFrame struct {
+	token  *Token
+	key    TokenKey
+	close  TokenKey
+	value  string
+	line   int
+	offset int
+}
+
+// pairBracket sets the depth of the token and links the close token to the open one.
+// In async mode the open token is linked to the close one by the stream, see Stream.receive.
+func (p *parsing) pairBracket(token *Token) {
+	token.depth = len(p.brackets)
+	for _, pair := range p.t.brackets {
+		if token.key == pair.Open {
+			p.brackets = append(p.brackets, bracketFrame{
+				token:  token,
+				key:    token.key,
+				close:  pair.Close,
+				value:  string(token.value),
+				line:   token.line,
+				offset: token.offset,
+			})
+			return
+		}
+		if token.key != pair.Close {
+			continue
+		}
+		for i := len(p.brackets) - 1; i >= 0; i-- {
+			if p.brackets[i].close == token.key {
+				// inner brackets are not closed
+				for _, f := range p.brackets[i+1:] {
+					p.unclosedBracket(f)
+				}
+				// the open token is nil if it is removed from the stream, see Stream.Remove
+				token.pair = p.brackets[i].token
+				if token.pair != nil && !p.detached {
+					token.pair.pair = token
+				}
+				token.depth = i
+				p.brackets = p.brackets[:i]
+				return
+			}
+		}
+		p.diagnostics = append(p.diagnostics, Diagnostic{
+			Line:    token.line,
+			Offset:  token.offset,
+			Message: fmt.Sprintf("unexpected close bracket %s %q", p.t.KeyName(token.key), token.value),
+		})
+		return
+	}
+}
+
+// closeBrackets reports brackets which are not closed at the end of the data.
+func (p *parsing) closeBrackets() {
+	for _, f := range p.brackets {
+		p.unclosedBracket(f)
+	}
+	p.brackets = nil
+}
+
+func (p *parsing) unclosedBracket(f bracketFrame) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Line:    f.line,
+		Offset:  f.offset,
+		Message: fmt.Sprintf("bracket %s %q is not closed", p.t.KeyName(f.key), f.value),
+	})
+}
+
+// pairBrackets pairs brackets of stitched tokens, see ParseBytesParallel.
+// Diagnostics of brackets are merged into `diagnostics` in the same order as the sequential parser reports them.
+func (t *Tokenizer) pairBrackets(head *Token, diagnostics []Diagnostic) []Diagnostic {
+	p := &parsing{t: t}
+	i := 0
+	for token := head; token != nil; token = token.next {
+		for ; i < len(diagnostics) && diagnostics[i].Offset <= token.offset; i++ {
+			p.diagnostics = append(p.diagnostics, diagnostics[i])
+		}
+		p.pairBracket(token)
+	}
+	p.diagnostics = append(p.diagnostics, diagnostics[i:]...)
+	p.closeBrackets()
+	return p.diagnostics
+}
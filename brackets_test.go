@@ -0,0 +1,107 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrackets(t *testing.T) {
+	parenOpen := TokenKey(10)
+	parenClose := TokenKey(11)
+	squareOpen := TokenKey(12)
+	squareClose := TokenKey(13)
+	curlyOpen := TokenKey(14)
+	curlyClose := TokenKey(15)
+	quoteKey := TokenKey(16)
+	tokenizer := New()
+	tokenizer.DefineTokens(parenOpen, []string{"("}).DefineTokens(parenClose, []string{")"})
+	tokenizer.DefineTokens(squareOpen, []string{"["}).DefineTokens(squareClose, []string{"]"})
+	tokenizer.DefineTokens(curlyOpen, []string{"{"}).DefineTokens(curlyClose, []string{"}"})
+	tokenizer.DefineStringToken(quoteKey, `"`, `"`).AddInjection(curlyOpen, curlyClose)
+	tokenizer.DefineBrackets(parenOpen, parenClose).DefineBrackets(squareOpen, squareClose).DefineBrackets(curlyOpen, curlyClose)
+	tokenizer.NameKey(parenOpen, "TParenOpen").NameKey(parenClose, "TParenClose").NameKey(squareOpen, "TSquareOpen").NameKey(curlyOpen, "TCurlyOpen")
+	require.Empty(t, tokenizer.Validate())
+
+	t.Run("balanced", func(t *testing.T) {
+		stream := tokenizer.ParseString(`f(a, [b, "x{c}"]) g`)
+		ids, depths := streamPairs(stream)
+		require.Equal(t, []int{-1, 13, -1, -1, 12, -1, -1, -1, 10, -1, 8, -1, 4, 1, -1}, ids)
+		require.Equal(t, []int{0, 0, 1, 1, 1, 2, 2, 2, 2, 3, 2, 2, 1, 0, 0}, depths)
+		require.Empty(t, stream.Diagnostics())
+	})
+
+	t.Run("unbalanced", func(t *testing.T) {
+		stream := tokenizer.ParseString("a ) ( [ b ) {\n(")
+		ids, depths := streamPairs(stream)
+		require.Equal(t, []int{-1, -1, 5, -1, -1, 2, -1, -1}, ids)
+		require.Equal(t, []int{0, 0, 0, 1, 2, 0, 0, 1}, depths)
+		require.Equal(t, []Diagnostic{
+			{Line: 1, Offset: 2, Message: `unexpected close bracket TParenClose ")"`},
+			{Line: 1, Offset: 6, Message: `bracket TSquareOpen "[" is not closed`},
+			{Line: 1, Offset: 12, Message: `bracket TCurlyOpen "{" is not closed`},
+			{Line: 2, Offset: 14, Message: `bracket TParenOpen "(" is not closed`},
+		}, stream.Diagnostics())
+	})
+
+	var source strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&source, "f%d(a, [b, {c: \"x{%d}\"}]) ", i, i)
+		if i%10 == 0 {
+			source.WriteString("{\n")
+		}
+		if i%10 == 9 {
+			source.WriteString("}\n")
+		}
+	}
+	source.WriteString("] (")
+	expectedIDs, expectedDepths := streamPairs(tokenizer.ParseString(source.String()))
+	expectedDiagnostics := tokenizer.ParseString(source.String()).Diagnostics()
+	require.Len(t, expectedDiagnostics, 2)
+
+	t.Run("stream", func(t *testing.T) {
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 16)
+		ids, depths := streamPairs(stream)
+		require.Equal(t, expectedIDs, ids)
+		require.Equal(t, expectedDepths, depths)
+		require.Equal(t, expectedDiagnostics, stream.Diagnostics())
+	})
+
+	t.Run("async", func(t *testing.T) {
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 16).Async(2)
+		defer stream.Close()
+		ids, depths := streamPairs(stream)
+		require.Equal(t, expectedIDs, ids)
+		require.Equal(t, expectedDepths, depths)
+		require.Equal(t, expectedDiagnostics, stream.Diagnostics())
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		stream := tokenizer.parseParallel([]byte(source.String()), 4, parallelLayout{minSegment: 256, syncWindow: parallelSyncWindow})
+		ids, depths := streamPairs(stream)
+		require.Equal(t, expectedIDs, ids)
+		require.Equal(t, expectedDepths, depths)
+		require.Equal(t, expectedDiagnostics, stream.Diagnostics())
+	})
+
+	t.Run("history", func(t *testing.T) {
+		stream := tokenizer.ParseStream(strings.NewReader("( a b c d e f g )"), 4).SetHistorySize(2)
+		open := stream.CurrentToken()
+		stream.GoTo(8)
+		require.Equal(t, 6, stream.HeadToken().ID())
+		require.Equal(t, 0, stream.CurrentToken().Pair().ID())
+		require.Same(t, open, stream.CurrentToken().Pair())
+		stream.Close()
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		tokenizer := New().DefineTokens(parenOpen, []string{"("}).DefineBrackets(parenOpen, parenClose).DefineBrackets(1, 1)
+		require.Equal(t, []Problem{
+			{Level: ProblemError, Key: 1, Message: "brackets TokenKey(1) and TokenKey(1) are ignored: keys must be positive and different"},
+			{Level: ProblemError, Key: parenClose, Message: "bracket key TokenKey(11) is not defined"},
+		}, tokenizer.Validate())
+		require.Equal(t, []BracketPair{{parenOpen, parenClose}}, tokenizer.Clone().Brackets())
+	})
+}
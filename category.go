@@ -0,0 +1,181 @@
+package tokenizer
+
+import "fmt"
+
+// Category is a kind of tokens which the parser tries at the current position.
+type Category int
+
+const (
+	// CategoryToken — user defined tokens, see Tokenizer.DefineTokens.
+	CategoryToken Category = iota + 1
+	// CategoryKeyword — keywords.
+	CategoryKeyword
+	// CategoryNumber — integer and float numbers, including signed numbers.
+	CategoryNumber
+	// CategoryString — framed strings, see Tokenizer.DefineStringToken.
+	CategoryString
+)
+
+// defaultCategories is the default order of categories.
+var defaultCategories = []Category{CategoryToken, CategoryKeyword, CategoryNumber, CategoryString}
+
+var categoryNames = map[Category]string{
+	CategoryToken:   "token",
+	CategoryKeyword: "keyword",
+	CategoryNumber:  "number",
+	CategoryString:  "string",
+}
+
+func (c Category) String() string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Category(%d)", int(c))
+}
+
+// SetPriority sets the order in which categories are tried at the current position.
+// The first category that matches wins. In maximal munch mode (see UseMaximalMunch) the order resolves ties.
+// Categories not listed are tried after listed ones in the default order: tokens, keywords, numbers, strings.
+//
+//	// a number `1` wins over a token `1st`
+//	parser.SetPriority(tokenizer.CategoryNumber)
+//
+// Note: by default a signed number is tried before tokens, so `-1` is a number even if `-` is defined.
+// With the explicit priority a signed number is a number as any other.
+func (t *Tokenizer) SetPriority(categories ...Category) *Tokenizer {
+	t.mutable()
+	order := make([]Category, 0, len(defaultCategories))
+	for _, c := range categories {
+		if _, ok := categoryNames[c]; ok && !categoryExists(order, c) {
+			order = append(order, c)
+		}
+	}
+	for _, c := range defaultCategories {
+		if !categoryExists(order, c) {
+			order = append(order, c)
+		}
+	}
+	t.categories = order
+	return t
+}
+
+// UseMaximalMunch enables maximal munch mode: the parser picks the category with the longest match at the current position.
+// A framed string competes by the length of its start token. Ties are resolved by priority, see SetPriority.
+//
+//	parser.DefineTokens(TMinus, []string{"-"})
+//	parser.DefineStringToken(TComment, "-->", "\n")
+//	parser.UseMaximalMunch() // `--> comment` is a string, `-` is a token
+func (t *Tokenizer) UseMaximalMunch() *Tokenizer {
+	t.mutable()
+	t.maximalMunch = true
+	if t.categories == nil {
+		t.categories = append([]Category(nil), defaultCategories...)
+	}
+	return t
+}
+
+// Priority returns the order of categories.
+func (t *Tokenizer) Priority() []Category {
+	if t.categories == nil {
+		return append([]Category(nil), defaultCategories...)
+	}
+	return append([]Category(nil), t.categories...)
+}
+
+// IsMaximalMunch checks if maximal munch mode is enabled, see UseMaximalMunch.
+func (t *Tokenizer) IsMaximalMunch() bool {
+	return t.maximalMunch
+}
+
+// precedes checks if category `a` is tried before category `b`.
+func (t *Tokenizer) precedes(a, b Category) bool {
+	for _, c := range t.Priority() {
+		if c == a {
+			return true
+		} else if c == b {
+			return false
+		}
+	}
+	return false
+}
+
+func categoryExists(categories []Category, c Category) bool {
+	for _, category := range categories {
+		if category == c {
+			return true
+		}
+	}
+	return false
+}
+
+// parseByPriority parses the token of the first matched category or of the longest match in maximal munch mode.
+func (p *parsing) parseByPriority(class byteClass) bool {
+	if !p.t.maximalMunch {
+		for _, c := range p.t.categories {
+			if p.parseCategory(c, class) {
+				return true
+			}
+		}
+		return false
+	}
+	var (
+		best    Category
+		longest int
+	)
+	for _, c := range p.t.categories {
+		if n := p.measure(c, class); n > longest {
+			best, longest = c, n
+		}
+	}
+	return longest > 0 && p.parseCategory(best, class)
+}
+
+// parseCategory parses the token of the category at the current position.
+func (p *parsing) parseCategory(c Category, class byteClass) bool {
+	switch c {
+	case CategoryToken:
+		return class&classToken != 0 && p.parseToken()
+	case CategoryKeyword:
+		return class&(classKeyword|classMultiByte) != 0 && p.parseKeyword()
+	case CategoryNumber:
+		return class&(classNumber|classSign) != 0 && p.parseNumber()
+	case CategoryString:
+		return class&classString != 0 && p.parseQuote()
+	}
+	return false
+}
+
+// measure returns the length of the token of the category at the current position or 0 if the category doesn't match.
+// The pointer is not moved.
+func (p *parsing) measure(c Category, class byteClass) int {
+	pos := p.pos
+	switch c {
+	case CategoryToken:
+		if class&classToken != 0 {
+			if ref := p.matchToken(); ref != nil {
+				return len(ref.Token)
+			}
+		}
+	case CategoryKeyword:
+		if class&(classKeyword|classMultiByte) != 0 && p.scanKeyword() != -1 {
+			n := p.pos - pos
+			p.seek(pos)
+			return n
+		}
+	case CategoryNumber:
+		if class&(classNumber|classSign) != 0 {
+			if start, _ := p.scanNumber(); start != -1 {
+				n := p.pos + p.matchNumberSuffix() - pos
+				p.seek(pos)
+				return n
+			}
+		}
+	case CategoryString:
+		if class&classString != 0 {
+			if q := p.matchQuote(); q != nil {
+				return len(q.StartToken)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package tokenizer
+
+import "fmt"
+
+// Channel is a group of tokens, like comments, which the stream may skip during navigation.
+// Tokens of the channel remain in the stream, see Stream.UseChannels.
+type Channel uint8
+
+const (
+	// ChannelDefault is the channel of all tokens by default. Only tokens of this channel are visible in the stream by default.
+	ChannelDefault Channel = 0
+	// ChannelHidden is the channel of tokens which are not interesting for the grammar: comments, whitespaces, etc.
+	ChannelHidden Channel = 1
+	// MaxChannel is the maximal channel.
+	MaxChannel Channel = 63
+)
+
+// SetChannel assigns tokens of keys to the channel.
+// Keys may be keys of custom tokens, keys of framed strings (see DefineStringToken) or built-in keys like TokenKeyword.
+// The key of the framed string has priority over TokenString, so comments may be hidden while other strings are not
+// and vice versa.
+//
+//	parser.DefineStringToken(TComment, "/*", "*/")
+//	parser.SetChannel(tokenizer.ChannelHidden, TComment)
+//
+// By default, the stream skips tokens of channels other than ChannelDefault, see Stream.UseChannels.
+func (t *Tokenizer) SetChannel(channel Channel, keys ...TokenKey) *Tokenizer {
+	t.mutable()
+	if channel > MaxChannel {
+		t.rejected = append(t.rejected, rejection{method: "SetChannel", Problem: Problem{
+			Level:   ProblemError,
+			Message: fmt.Sprintf("channel %d is ignored: channel must be less than or equal to %d", channel, MaxChannel),
+		}})
+		return t
+	}
+	for _, key := range keys {
+		if t.channels == nil {
+			t.channels = map[TokenKey]Channel{}
+		}
+		t.channels[key] = channel
+	}
+	return t
+}
+
+// ChannelOf returns the channel of tokens of the key, see SetChannel.
+func (t *Tokenizer) ChannelOf(key TokenKey) Channel {
+	return t.channels[key]
+}
+
+// channelOf returns the channel of the token.
+func (t *Tokenizer) channelOf(token *Token) Channel {
+	if token.string != nil {
+		if channel, ok := t.channels[token.string.Key]; ok {
+			return channel
+		}
+	}
+	return t.channels[token.key]
+}
+
+// UseChannels sets channels of tokens which are visible for navigation of the stream: GoNext, GoPrev, Peek, NextToken,
+// IsNextSequence, etc. Tokens of other channels are skipped but remain in the stream, see HiddenBefore and HiddenAfter.
+// Without channels only ChannelDefault is visible.
+// If the current token becomes invisible the pointer moves to the next visible token.
+// The pointer is not moved back to tokens which become visible, use GoTo:
+//
+//	stream.UseChannels(tokenizer.ChannelDefault, tokenizer.ChannelHidden).GoTo(0) // all tokens with comments
+func (s *Stream) UseChannels(channels ...Channel) *Stream {
+	s.channels = 0
+	for _, channel := range channels {
+		if channel <= MaxChannel {
+			s.channels |= 1 << channel
+		}
+	}
+	return s.skipHidden()
+}
+
+// Channels returns channels which are visible for navigation of the stream, see UseChannels.
+func (s *Stream) Channels() []Channel {
+	var channels []Channel
+	for channel := ChannelDefault; channel <= MaxChannel; channel++ {
+		if s.visibleChannel(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// visibleChannel checks if tokens of the channel are visible for navigation.
+func (s *Stream) visibleChannel(channel Channel) bool {
+	if s.channels == 0 {
+		return channel == ChannelDefault
+	}
+	return s.channels&(1<<channel) != 0
+}
+
+// visible checks if the token is visible for navigation.
+func (s *Stream) visible(token *Token) bool {
+	return s.visibleChannel(token.channel)
+}
+
+// skipHidden moves the pointer to the next visible token if the current token is hidden.
+func (s *Stream) skipHidden() *Stream {
+	if s.current != undefToken && !s.visible(s.current) {
+		s.GoNext()
+	}
+	return s
+}
+
+// HiddenBefore returns hidden tokens (see UseChannels) between the previous visible token and the current token.
+// At the end of the stream the method returns hidden tokens after the last visible token.
+// Tokens which are evicted from the history (see SetHistorySize) are not returned.
+// Do not save tokens into variables — tokens may be changed at any time.
+func (s *Stream) HiddenBefore() []*Token {
+	var hidden []*Token
+	if s.current == undefToken {
+		if s.prev != nil { // we at the end of the stream
+			for token := s.nextOf(s.prev); token != nil; token = s.nextOf(token) {
+				hidden = append(hidden, token)
+			}
+		}
+		return hidden
+	}
+	for token := s.prevOf(s.current); token != nil && !s.visible(token); token = s.prevOf(token) {
+		hidden = append(hidden, token)
+	}
+	reverseTokens(hidden)
+	return hidden
+}
+
+// HiddenAfter returns hidden tokens (see UseChannels) between the current token and the next visible token.
+// At the beginning of the stream the method returns hidden tokens before the first visible token.
+// In the infinite stream next data-chunks are parsed if needed.
+// Do not save tokens into variables — tokens may be changed at any time.
+func (s *Stream) HiddenAfter() []*Token {
+	var hidden []*Token
+	if s.current == undefToken {
+		if s.next != nil { // we at the beginning of the stream
+			for token := s.prevOf(s.next); token != nil; token = s.prevOf(token) {
+				hidden = append(hidden, token)
+			}
+			reverseTokens(hidden)
+		}
+		return hidden
+	}
+	for token := s.successor(s.current); token != nil && !s.visible(token); token = s.successor(token) {
+		hidden = append(hidden, token)
+	}
+	return hidden
+}
+
+func reverseTokens(tokens []*Token) {
+	for i, j := 0, len(tokens)-1; i < j; i, j = i+1, j-1 {
+		tokens[i], tokens[j] = tokens[j], tokens[i]
+	}
+}
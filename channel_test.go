@@ -0,0 +1,151 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannels(t *testing.T) {
+	equalKey := TokenKey(10)
+	semicolonKey := TokenKey(11)
+	parenOpen := TokenKey(12)
+	parenClose := TokenKey(13)
+	commentKey := TokenKey(14)
+	noteKey := TokenKey(15)
+	tokenizer := New()
+	tokenizer.DefineTokens(equalKey, []string{"="}).DefineTokens(semicolonKey, []string{";"})
+	tokenizer.DefineTokens(parenOpen, []string{"("}).DefineTokens(parenClose, []string{")"})
+	tokenizer.DefineStringToken(commentKey, "/*", "*/")
+	tokenizer.DefineStringToken(noteKey, "#", "\n")
+	tokenizer.DefineStringToken(TokenString, `"`, `"`)
+	tokenizer.SetChannel(ChannelHidden, commentKey, noteKey)
+	require.Equal(t, ChannelHidden, tokenizer.ChannelOf(commentKey))
+	require.Equal(t, ChannelDefault, tokenizer.ChannelOf(equalKey))
+
+	const source = "/* head */ a = 1; # note\nb = /* x */ 2; /* tail */"
+
+	t.Run("navigation", func(t *testing.T) {
+		stream := tokenizer.ParseString(source)
+		defer stream.Close()
+		require.Equal(t, 1, stream.CurrentToken().ID())
+		require.Equal(t, []string{"/* head */"}, tokenValues(stream.HiddenBefore()))
+		require.Empty(t, stream.HiddenAfter())
+		require.Equal(t, ChannelHidden, stream.HeadToken().Channel())
+
+		stream.GoTo(5)
+		require.Equal(t, "b", stream.CurrentToken().ValueString())
+		require.Equal(t, ";", stream.PrevToken().ValueString())
+		require.Equal(t, []string{"# note\n"}, tokenValues(stream.HiddenBefore()))
+
+		stream.GoNext()
+		require.Equal(t, "2", stream.NextToken().ValueString())
+		require.Equal(t, TokenInteger, stream.PeekKey(1))
+		require.Equal(t, "b", stream.Peek(-1).ValueString())
+		require.True(t, stream.IsNextSequence(TokenInteger, semicolonKey))
+		require.Equal(t, []string{"/* x */"}, tokenValues(stream.HiddenAfter()))
+
+		stream.GoTo(8)
+		require.Equal(t, 9, stream.CurrentToken().ID())
+		stream.GoTo(8)
+		require.Equal(t, 7, stream.CurrentToken().ID())
+		stream.GoTo(0)
+		require.Equal(t, 1, stream.CurrentToken().ID())
+		stream.GoTo(100)
+		require.Equal(t, 10, stream.CurrentToken().ID())
+
+		require.False(t, stream.GoNext().IsValid())
+		require.Equal(t, []string{"/* tail */"}, tokenValues(stream.HiddenBefore()))
+		require.Equal(t, ";", stream.GoPrev().CurrentToken().ValueString())
+		stream.GoTo(1).GoPrev()
+		require.False(t, stream.IsValid())
+		require.Equal(t, []string{"/* head */"}, tokenValues(stream.HiddenAfter()))
+	})
+
+	t.Run("channels", func(t *testing.T) {
+		stream := tokenizer.ParseString(source)
+		require.Equal(t, []Channel{ChannelDefault}, stream.Channels())
+		require.Equal(t, []string{"a", "=", "1", ";", "b", "=", "2", ";"}, streamValues(stream))
+
+		stream = tokenizer.ParseString(source).UseChannels(ChannelDefault, ChannelHidden)
+		require.Equal(t, []Channel{ChannelDefault, ChannelHidden}, stream.Channels())
+		require.Equal(t, "a", stream.CurrentToken().ValueString())
+		stream.GoTo(0)
+		require.Equal(t, "/* head */", stream.CurrentToken().ValueString())
+		require.Len(t, streamValues(stream), 12)
+
+		stream = tokenizer.ParseString(source).UseChannels(ChannelHidden).GoTo(0)
+		require.Equal(t, []string{"/* head */", "# note\n", "/* x */", "/* tail */"}, streamValues(stream))
+
+		// the key of the string has priority over TokenString
+		quoted := tokenizer.Clone().SetChannel(ChannelHidden, TokenString).SetChannel(ChannelDefault, commentKey)
+		require.Equal(t, []string{"/* c */", "a", "b"}, streamValues(quoted.ParseString(`/* c */ "s" a # n
+b`)))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var source strings.Builder
+		for i := 0; i < 50; i++ {
+			source.WriteString("a = /* long comment */ /* and another one */ 1; # note\n")
+		}
+		expected := streamValues(tokenizer.ParseString(source.String()))
+		require.Len(t, expected, 200)
+
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 8)
+		require.Equal(t, expected, streamValues(stream))
+
+		stream = tokenizer.ParseStream(strings.NewReader(source.String()), 8).Async(2)
+		require.Equal(t, expected, streamValues(stream))
+		stream.Close()
+
+		stream = tokenizer.ParseStream(strings.NewReader(source.String()), 8)
+		stream.GoNext()
+		require.Equal(t, []string{"/* long comment */", "/* and another one */"}, tokenValues(stream.HiddenAfter()))
+
+		stream = tokenizer.ParseStream(strings.NewReader("a /* x */ /* y */ /* z */ b"), 4)
+		require.Equal(t, "b", stream.NextToken().ValueString())
+		require.True(t, stream.GoNextIfNextIs(TokenKeyword))
+		require.Equal(t, "b", stream.CurrentToken().ValueString())
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		stream := tokenizer.parseParallel([]byte(strings.Repeat(source+"\n", 10)), 4, parallelLayout{minSegment: 16, syncWindow: parallelSyncWindow})
+		require.Equal(t, "a", stream.CurrentToken().ValueString())
+		require.Len(t, streamValues(stream), 80)
+	})
+
+	t.Run("view", func(t *testing.T) {
+		stream := tokenizer.ParseString("f(/* a */ a, /* b */ b) c")
+		stream.GoNext()
+		args, err := stream.SubStream(parenOpen, parenClose)
+		require.NoError(t, err)
+		require.Equal(t, "a", args.CurrentToken().ValueString())
+		require.Equal(t, []string{"/* a */"}, tokenValues(args.HiddenBefore()))
+		require.Equal(t, []string{"a", ",", "b"}, streamValues(args))
+		args.Close()
+		require.Equal(t, "c", stream.CurrentToken().ValueString())
+	})
+
+	t.Run("excerpt", func(t *testing.T) {
+		stream := tokenizer.ParseString(source).GoTo(9)
+		require.Equal(t, "2 | b = /* x */ 2; /* tail */\n  |             ^", stream.Excerpt(stream.CurrentToken(), 0))
+	})
+
+	t.Run("configuration", func(t *testing.T) {
+		clone := tokenizer.Clone()
+		require.Equal(t, ChannelHidden, clone.ChannelOf(noteKey))
+
+		layer := New().SetChannel(2, commentKey, equalKey)
+		extended := tokenizer.Clone()
+		require.NoError(t, extended.Extend(layer, CollisionKeep))
+		require.Equal(t, ChannelHidden, extended.ChannelOf(commentKey))
+		require.Equal(t, Channel(2), extended.ChannelOf(equalKey))
+		require.NoError(t, extended.Extend(layer, CollisionReplace))
+		require.Equal(t, Channel(2), extended.ChannelOf(commentKey))
+
+		require.Equal(t, []Problem{
+			{Level: ProblemError, Message: "channel 64 is ignored: channel must be less than or equal to 63"},
+		}, New().SetChannel(64, equalKey).Validate())
+	})
+}
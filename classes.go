@@ -0,0 +1,90 @@
+package tokenizer
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// byteClass is a set of roles of a byte in the source.
+type byteClass uint8
+
+const (
+	// classSpace — byte is whitespace
+	classSpace byteClass = 1 << iota
+	// classKeyword — byte may start and continue a keyword: ASCII letter or major symbol
+	classKeyword
+	// classKeywordTail — byte may continue a keyword: minor symbol
+	classKeywordTail
+	// classNumber — byte may start a number: digit or decimal point
+	classNumber
+	// classSign — byte is a sign of a signed number
+	classSign
+	// classToken — byte is the first byte of a user defined token
+	classToken
+	// classString — byte is the first byte of a framed string
+	classString
+	// classMultiByte — byte is a part of multibyte rune, a keyword may start from it
+	classMultiByte
+)
+
+// classify builds byte classification table of the tokenizer.
+// The table allows to dispatch the main loop of the parser with one lookup.
+func (t *Tokenizer) classify() {
+	var classes [256]byteClass
+	for _, ws := range t.wSpaces {
+		if ws != 0 {
+			classes[ws] |= classSpace
+		}
+	}
+	for b := 'a'; b <= 'z'; b++ {
+		classes[b] |= classKeyword
+		classes[b-'a'+'A'] |= classKeyword
+	}
+	for _, r := range t.kwMajorSymbols {
+		if r > 0 && r < utf8.RuneSelf {
+			classes[r] |= classKeyword
+		}
+	}
+	for _, r := range t.kwMinorSymbols {
+		if r > 0 && r < utf8.RuneSelf {
+			classes[r] |= classKeywordTail
+		}
+	}
+	for b := '0'; b <= '9'; b++ {
+		classes[b] |= classNumber
+	}
+	if t.decimalSeparator() == '.' {
+		classes['.'] |= classNumber
+	}
+	if t.allowNumberSign {
+		classes['-'] |= classSign
+		classes['+'] |= classSign
+	}
+	for b, node := range t.trie.root {
+		if node != nil {
+			classes[b] |= classToken
+		}
+	}
+	for _, q := range t.quotes {
+		if len(q.StartToken) > 0 {
+			classes[q.StartToken[0]] |= classString
+		}
+		q.classified = append(q.classified[:0:0], q.StartToken...)
+		q.classify()
+	}
+	for b := utf8.RuneSelf; b < len(classes); b++ {
+		classes[b] |= classMultiByte
+	}
+	t.classes = classes
+}
+
+// reclassified checks if start tokens of strings were changed directly after classification, see classify.
+// Then the table doesn't know first bytes of strings and the parser tries strings at any byte.
+func (t *Tokenizer) reclassified() bool {
+	for _, q := range t.quotes {
+		if !bytes.Equal(q.StartToken, q.classified) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package tokenizer
+
+import "fmt"
+
+// Collision defines how definitions of the same key are resolved when one tokenizer is layered over another.
+// See Tokenizer.Extend.
+type Collision int
+
+const (
+	// CollisionReplace replaces tokens (or framed strings) of the key with the layer's ones.
+	CollisionReplace Collision = iota
+	// CollisionKeep keeps existing tokens (or framed strings) of the key, the layer's ones are ignored.
+	CollisionKeep
+	// CollisionMerge appends the layer's tokens (or framed strings) to the existing ones of the key.
+	CollisionMerge
+	// CollisionError rejects the layer if any key is defined in both tokenizers.
+	CollisionError
+)
+
+// Clone returns independent deep copy of the tokenizer with its own pool of tokens.
+// The clone of compiled tokenizer is not compiled, so it may be changed.
+//
+//	postgres := sql.Clone().DefineTokens(TCast, []string{"::"})
+func (t *Tokenizer) Clone() *Tokenizer {
+	c := New()
+	c.stopOnUnknown = t.stopOnUnknown
+	c.allowNumberUnderscore = t.allowNumberUnderscore
+	c.rejectUnknownSuffixes = t.rejectUnknownSuffixes
+	c.allowNumberSign = t.allowNumberSign
+	c.maximalMunch = t.maximalMunch
+	c.categories = append([]Category(nil), t.categories...)
+	for _, key := range t.keys {
+		c.keys = append(c.keys, key)
+		c.tokens[key] = copyRefs(t.tokens[key])
+	}
+	for _, q := range t.quotes {
+		c.quotes = append(c.quotes, q.clone(c))
+	}
+	c.wSpaces = append([]byte(nil), t.wSpaces...)
+	c.kwMajorSymbols = append([]rune(nil), t.kwMajorSymbols...)
+	c.kwMinorSymbols = append([]rune(nil), t.kwMinorSymbols...)
+	c.numberSuffixes = append([][]byte(nil), t.numberSuffixes...)
+	c.operandKeys = append([]TokenKey(nil), t.operandKeys...)
+	c.rejected = append([]rejection(nil), t.rejected...)
+	c.brackets = append([]BracketPair(nil), t.brackets...)
+	for key, channel := range t.channels {
+		c.SetChannel(channel, key)
+	}
+	if t.numberFormat != nil {
+		c.SetNumberFormat(t.numberFormat.DecimalSeparator, append([]byte(nil), t.numberFormat.GroupSeparators...))
+	}
+	for key, name := range t.names {
+		c.NameKey(key, name)
+	}
+	c.buildTrie()
+	c.classify()
+	return c
+}
+
+// Extend layers custom tokens and framed strings of the `layer` over the definitions of the tokenizer.
+// Keys defined in both tokenizers are resolved by `collision`.
+// Names of keys are taken from the layer if the key has no name or collision is CollisionReplace,
+// brackets of the layer are added if the open key has no pair or collision is CollisionReplace,
+// channels of keys (see SetChannel) are taken from the layer if the key has no channel or collision is CollisionReplace.
+// Other settings (whitespaces, keyword symbols, number options) of the tokenizer are not changed.
+// The tokenizer doesn't share any data with the layer after extending.
+//
+//	mysql := sql.Clone()
+//	err := mysql.Extend(mysqlOnly, tokenizer.CollisionReplace)
+func (t *Tokenizer) Extend(layer *Tokenizer, collision Collision) error {
+	t.mutable()
+	if collision == CollisionError {
+		for _, key := range layer.keys {
+			if _, exists := t.tokens[key]; exists {
+				return fmt.Errorf("tokens of key %s are already defined", t.KeyName(key))
+			}
+		}
+		for _, q := range layer.quotes {
+			if t.hasString(q.Key) {
+				return fmt.Errorf("string of key %s is already defined", t.KeyName(q.Key))
+			}
+		}
+	}
+	for _, key := range layer.keys {
+		refs := layer.tokens[key]
+		if _, exists := t.tokens[key]; !exists {
+			t.keys = append(t.keys, key)
+			t.tokens[key] = copyRefs(refs)
+		} else if collision == CollisionReplace {
+			t.tokens[key] = copyRefs(refs)
+		} else if collision == CollisionMerge {
+			for _, ref := range refs {
+				if !t.hasToken(key, ref.Token) {
+					t.tokens[key] = append(t.tokens[key], &tokenRef{Key: ref.Key, Token: ref.Token})
+				}
+			}
+		}
+	}
+	var quotes []*StringSettings
+	for _, q := range layer.quotes {
+		if !t.hasString(q.Key) || collision == CollisionMerge {
+			quotes = append(quotes, q.clone(t))
+		} else if collision == CollisionReplace {
+			t.UndefineString(q.Key)
+			quotes = append(quotes, q.clone(t))
+		}
+	}
+	t.quotes = append(t.quotes, quotes...)
+	for _, pair := range layer.brackets {
+		if !t.hasBrackets(pair.Open) || collision == CollisionReplace {
+			t.DefineBrackets(pair.Open, pair.Close)
+		}
+	}
+	for key, channel := range layer.channels {
+		if _, exists := t.channels[key]; !exists || collision == CollisionReplace {
+			t.SetChannel(channel, key)
+		}
+	}
+	for key, name := range layer.names {
+		if _, named := t.names[key]; !named || collision == CollisionReplace {
+			t.NameKey(key, name)
+		}
+	}
+	t.buildTrie()
+	t.classify()
+	return nil
+}
+
+// copyRefs returns copies of tokens, so tokenizers don't share them.
+func copyRefs(refs []*tokenRef) []*tokenRef {
+	copies := make([]*tokenRef, len(refs))
+	for i, ref := range refs {
+		copies[i] = &tokenRef{Key: ref.Key, Token: ref.Token}
+	}
+	return copies
+}
+
+// hasString checks if any framed string with the key is defined.
+func (t *Tokenizer) hasString(key TokenKey) bool {
+	for _, q := range t.quotes {
+		if q.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBrackets checks if the pair of brackets with the open key is defined.
+func (t *Tokenizer) hasBrackets(open TokenKey) bool {
+	for _, pair := range t.brackets {
+		if pair.Open == open {
+			return true
+		}
+	}
+	return false
+}
+
+// hasToken checks if the token is defined for the key.
+func (t *Tokenizer) hasToken(key TokenKey, token []byte) bool {
+	for _, ref := range t.tokens[key] {
+		if string(ref.Token) == string(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a deep copy of settings for the tokenizer.
+func (q *StringSettings) clone(t *Tokenizer) *StringSettings {
+	c := &StringSettings{
+		Key:          q.Key,
+		StartToken:   append([]byte(nil), q.StartToken...),
+		EndToken:     append([]byte(nil), q.EndToken...),
+		EscapeSymbol: q.EscapeSymbol,
+		Injects:      append([]QuoteInjectSettings(nil), q.Injects...),
+		tokenizer:    t,
+	}
+	for _, special := range q.SpecSymbols {
+		c.SpecSymbols = append(c.SpecSymbols, append([]byte(nil), special...))
+	}
+	return c
+}
@@ -0,0 +1,18 @@
+package tokenizer
+
+import "fmt"
+
+// Diagnostic describes a problem found by the parser in the source.
+// Diagnostics don't stop parsing, see Stream.Diagnostics.
+type Diagnostic struct {
+	// Line number in input string. Line numbers starts from 1.
+	Line int
+	// Offset is the byte position in input string (from start).
+	Offset int
+	// Message describes the problem.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d (offset %d): %s", d.Line, d.Offset, d.Message)
+}
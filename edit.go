@@ -0,0 +1,283 @@
+package tokenizer
+
+import "bytes"
+
+// InsertBefore inserts the synthetic token (see Token.IsSynthetic) of the key and the value before the anchor token
+// and returns it. The synthetic token has the ID, the line and the offset of the anchor token and has no indent.
+// GoTo with the ID moves the pointer to the first token with the ID, so it reaches the synthetic token.
+// Inserted tokens are not paired as brackets (see Token.Pair) but have the depth of tokens around them.
+//
+//	stream.InsertBefore(stream.CurrentToken(), TSemicolon, ";")
+//
+// Returns TokenUndef token if the anchor is TokenUndef token.
+func (s *Stream) InsertBefore(anchor *Token, key TokenKey, value string) *Token {
+	if anchor == nil || anchor == undefToken {
+		return undefToken
+	}
+	token := s.synthetic(anchor, key, value)
+	if s.t.isCloseBracket(anchor.key) {
+		token.depth++
+	}
+	s.link(token, anchor, false)
+	return token
+}
+
+// InsertAfter inserts the synthetic token (see Token.IsSynthetic) of the key and the value after the anchor token
+// and returns it. The synthetic token has the ID of the anchor token and the position right after the anchor token,
+// see InsertBefore. GoTo with the ID moves the pointer to the anchor token, the synthetic token is reachable by GoNext.
+func (s *Stream) InsertAfter(anchor *Token, key TokenKey, value string) *Token {
+	if anchor == nil || anchor == undefToken {
+		return undefToken
+	}
+	token := s.synthetic(anchor, key, value)
+	if !anchor.IsSynthetic() {
+		token.offset += len(anchor.value)
+		token.line += bytes.Count(anchor.value, []byte{newLine})
+	}
+	if s.t.isOpenBracket(anchor.key) {
+		token.depth++
+	}
+	s.link(token, anchor, true)
+	return token
+}
+
+// Remove removes the token from the stream and releases it to the pool, so the token must not be used after removal.
+// If the pointer of the stream (or a mark, see Mark) points to the token, it is moved to the next token or,
+// at the end of the stream, the pointer moves out of the stream after the previous token.
+// Tokens of the view (see SubStream) are removed from the parent stream too, but open and close tokens
+// of live views must not be removed.
+func (s *Stream) Remove(token *Token) {
+	if token == nil || token == undefToken {
+		return
+	}
+	s.forward(token, nil)
+	s.unlink(token, nil)
+	s.release(token)
+}
+
+// Replace replaces the token by the synthetic token (see Token.IsSynthetic) of the key and the value and returns it.
+// The synthetic token has the ID, the position, the indent and the depth of the token, the pair of the bracket
+// (see Token.Pair) is kept if it is known. The pointer of the stream and marks are moved to the synthetic token.
+// The replaced token is released to the pool, see Remove.
+//
+//	stream.Replace(stream.CurrentToken(), TokenKeyword, "undefined")
+func (s *Stream) Replace(token *Token, key TokenKey, value string) *Token {
+	if token == nil || token == undefToken {
+		return undefToken
+	}
+	replacement := s.synthetic(token, key, value)
+	replacement.indent = token.indent
+	replacement.depth = token.depth
+	if pair := token.pair; pair != nil {
+		replacement.pair = pair
+		if pair.pair == token {
+			pair.pair = replacement
+		}
+		token.pair = nil
+	}
+	s.forward(token, replacement)
+	s.link(replacement, token, false)
+	s.unlink(token, replacement)
+	s.release(token)
+	return replacement
+}
+
+// forward passes the open bracket which waits for the close token to the substitute token,
+// so the parser pairs the close token with the substitute. Nil substitute means the close token will have no pair.
+func (s *Stream) forward(token, substitute *Token) {
+	if token.pair != nil || !s.t.isOpenBracket(token.key) {
+		return
+	}
+	root := s.root()
+	if root.p != nil {
+		for i := range root.p.brackets {
+			if root.p.brackets[i].token == token {
+				root.p.brackets[i].token = substitute
+			}
+		}
+	}
+	if root.async != nil { // the producer owns frames of brackets, the stream redirects pairs on receive
+		if root.async.forwards == nil {
+			root.async.forwards = map[*Token]*Token{}
+		}
+		root.async.forwards[token] = substitute
+	}
+}
+
+// Split splits the value of the token at the byte `at` into two tokens and returns the second one.
+// The token keeps the first part of the value, the second token has the ID of the token, the position of the part
+// in the source and no indent. The key of each part is the key of the custom token with the same value
+// (see DefineTokens) or the key of the token, so `>>` may be split into two `>` tokens of generics:
+//
+//	if stream.CurrentToken().Is(TShiftRight) {
+//		stream.Split(stream.CurrentToken(), 1) // `>` and `>`
+//	}
+//
+// Returns TokenUndef token if `at` is not inside the value.
+func (s *Stream) Split(token *Token, at int) *Token {
+	if token == nil || token == undefToken || at <= 0 || at >= len(token.value) {
+		return undefToken
+	}
+	tail := s.t.allocToken()
+	tail.id = token.id
+	tail.key = token.key
+	tail.value = token.value[at:]
+	tail.line, tail.offset = token.line, token.offset
+	if !token.IsSynthetic() {
+		tail.offset += at
+		tail.line += bytes.Count(token.value[:at], []byte{newLine})
+	}
+	tail.string = token.string
+	tail.format = token.format
+	// the injection starts at the first part and ends at the second one
+	tail.flags = token.flags &^ flagInjectionStart
+	token.flags &^= flagInjectionEnd
+	tail.depth = token.depth
+	// the number suffix is at the end of the value
+	tail.suffix = token.suffix
+	if tail.suffix > len(tail.value) {
+		tail.suffix = len(tail.value)
+	}
+	token.suffix -= tail.suffix
+	token.value = token.value[:at]
+	if key, ok := s.t.tokenKey(token.value); ok {
+		token.key = key
+		token.channel = s.t.channelOf(token)
+	}
+	if key, ok := s.t.tokenKey(tail.value); ok {
+		tail.key = key
+	}
+	tail.channel = s.t.channelOf(tail)
+	s.link(tail, token, true)
+	return tail
+}
+
+// tokenKey returns the key of the custom token with the value, see DefineTokens.
+func (t *Tokenizer) tokenKey(value []byte) (TokenKey, bool) {
+	for _, key := range t.keys {
+		if t.hasToken(key, value) {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+// synthetic creates the synthetic token at the position of the anchor token.
+func (s *Stream) synthetic(anchor *Token, key TokenKey, value string) *Token {
+	token := s.t.allocToken()
+	token.id = anchor.id
+	token.key = key
+	token.value = []byte(value)
+	token.line, token.offset = anchor.line, anchor.offset
+	token.depth = anchor.depth
+	token.flags = flagSynthetic
+	token.channel = s.t.channelOf(token)
+	return token
+}
+
+// link links the token before or after the anchor token.
+func (s *Stream) link(token, anchor *Token, after bool) {
+	if after {
+		token.prev, token.next = anchor, anchor.next
+	} else {
+		token.prev, token.next = anchor.prev, anchor
+	}
+	if token.prev != nil {
+		token.prev.next = token
+	}
+	if token.next != nil {
+		token.next.prev = token
+	}
+	visible := s.visible(token)
+	for st := s; st != nil; st = st.parent {
+		st.len++
+		if st.head == anchor && !after {
+			st.head = token
+		}
+		if visible { // the pointer out of the stream points to the first or the last token
+			if st.next == anchor && !after {
+				st.next = token
+			} else if st.prev == anchor && after {
+				st.prev = token
+			}
+		}
+	}
+	root := s.root()
+	if root.p != nil && root.p.ptr == anchor && after {
+		root.p.ptr = token
+	}
+	if root.async != nil && root.async.tail == anchor && after {
+		root.async.tail = token
+	}
+}
+
+// unlink unlinks the token from the stream. The pointer of the stream and marks are moved from the token
+// to the `substitute` token or to neighbor tokens if `substitute` is nil.
+func (s *Stream) unlink(token, substitute *Token) {
+	prev, next := substitute, substitute
+	if substitute == nil {
+		prev, next = s.preceding(token), s.following(token) // parses the next data-chunk if needed
+	}
+	for st := s; st != nil; st = st.parent {
+		st.len--
+		if st.head == token {
+			st.head = validateToken(st.nextOf(token))
+		}
+		position := Mark{current: st.current, prev: st.prev, next: st.next}
+		position.relocate(token, prev, next)
+		st.current, st.prev, st.next = position.current, position.prev, position.next
+		for _, m := range st.marks {
+			m.relocate(token, prev, next)
+		}
+		st.findOldest()
+	}
+	root := s.root()
+	if root.p != nil && root.p.ptr == token {
+		root.p.ptr = token.prev
+	}
+	if root.async != nil && root.async.tail == token {
+		root.async.tail = token.prev
+	}
+	if token.prev != nil {
+		token.prev.next = token.next
+	}
+	if token.next != nil {
+		token.next.prev = token.prev
+	}
+	token.prev, token.next = nil, nil
+}
+
+// root returns the stream which owns tokens of the view, see SubStream.
+func (s *Stream) root() *Stream {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// relocate moves the position from the removed token to the previous or the next token (TokenUndef token means
+// there is no such token).
+func (m *Mark) relocate(removed, prev, next *Token) {
+	if m.current == removed {
+		if next != undefToken {
+			m.current = next
+		} else {
+			m.current = undefToken
+			if prev != undefToken {
+				m.prev = prev
+			}
+		}
+	}
+	if m.prev == removed {
+		m.prev = nil
+		if prev != undefToken {
+			m.prev = prev
+		}
+	}
+	if m.next == removed {
+		m.next = nil
+		if next != undefToken {
+			m.next = next
+		}
+	}
+}
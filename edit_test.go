@@ -0,0 +1,206 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEdit(t *testing.T) {
+	lessKey := TokenKey(10)
+	greaterKey := TokenKey(11)
+	shiftKey := TokenKey(12)
+	parenOpen := TokenKey(13)
+	parenClose := TokenKey(14)
+	plusKey := TokenKey(15)
+	tokenizer := New()
+	tokenizer.DefineTokens(lessKey, []string{"<"}).DefineTokens(greaterKey, []string{">"})
+	tokenizer.DefineTokens(shiftKey, []string{">>"}).DefineTokens(plusKey, []string{"+"})
+	tokenizer.DefineTokens(parenOpen, []string{"("}).DefineTokens(parenClose, []string{")"})
+	tokenizer.DefineBrackets(parenOpen, parenClose)
+	tokenizer.NameKey(greaterKey, "TGreater").NameKey(shiftKey, "TShift").NameKey(plusKey, "TPlus")
+
+	t.Run("insert", func(t *testing.T) {
+		stream := tokenizer.ParseString("a + b")
+		defer stream.Close()
+		b := stream.GoTo(2).CurrentToken()
+		open := stream.InsertBefore(b, parenOpen, "(")
+		close := stream.InsertAfter(b, parenClose, ")")
+		head := stream.InsertBefore(stream.HeadToken(), TokenKeyword, "let")
+
+		require.True(t, open.IsSynthetic())
+		require.False(t, b.IsSynthetic())
+		require.Equal(t, 2, open.ID())
+		require.Equal(t, 4, open.Offset())
+		require.Equal(t, 5, close.Offset())
+		require.Equal(t, 0, open.Depth())
+		require.Same(t, head, stream.HeadToken())
+		require.Equal(t, 6, stream.len)
+		require.Equal(t, []int{0, 0, 1, 2, 2, 2}, streamIDs(stream))
+		require.Same(t, b, stream.CurrentToken())
+
+		require.Equal(t, []string{"let", "a", "+", "(", "b", ")"}, streamValues(stream.GoTo(0)))
+		require.Same(t, close, stream.GoPrev().CurrentToken())
+		require.Same(t, open, stream.GoTo(2).CurrentToken())
+		require.Same(t, open, stream.GoTo(0).GoTo(2).CurrentToken())
+		// tokens after the first token with the ID are reachable by GoNext only
+		require.Same(t, close, stream.GoNext().GoNext().CurrentToken())
+
+		require.Equal(t, undefToken, stream.InsertAfter(undefToken, plusKey, "+"))
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		stream := tokenizer.ParseString("a + b + c")
+		defer stream.Close()
+		mark := stream.GoTo(2).Mark()
+		stream.Remove(stream.CurrentToken())
+		require.Equal(t, "+", stream.CurrentToken().ValueString())
+		require.Equal(t, 1, stream.PrevToken().ID())
+		require.Equal(t, 4, stream.len)
+
+		stream.Remove(stream.HeadToken())
+		require.Equal(t, 1, stream.HeadToken().ID())
+		stream.GoTo(4)
+		stream.Remove(stream.CurrentToken())
+		require.False(t, stream.IsValid())
+		require.Equal(t, "+", stream.GoPrev().CurrentToken().ValueString())
+		require.Equal(t, "+", stream.Rewind(mark).CurrentToken().ValueString())
+		require.Equal(t, 3, stream.CurrentToken().ID())
+		stream.Release(mark)
+		require.Equal(t, []string{"+", "+"}, streamValues(stream.GoTo(0)))
+
+		// the position is not shifted by removed tokens
+		stream = tokenizer.ParseString("a = b\n\n  c")
+		stream.Remove(stream.GoTo(2).CurrentToken())
+		_, err := stream.Expect(plusKey)
+		require.EqualError(t, err, `3:3: syntax error: unexpected TokenKeyword "c", expected TPlus`)
+		require.Equal(t, "1 | a =  \n2 | \n3 |   c\n  |   ^", stream.Excerpt(stream.CurrentToken(), 2))
+		stream.Close()
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		stream := tokenizer.ParseString("f(a, b)")
+		defer stream.Close()
+		close := stream.GoTo(5).CurrentToken()
+		open := stream.Replace(close.Pair(), parenOpen, "[")
+		require.Same(t, open, close.Pair())
+		require.Same(t, close, open.Pair())
+		require.Equal(t, 1, open.ID())
+		require.Equal(t, 1, open.Offset())
+
+		stream.GoTo(2)
+		a := stream.Replace(stream.CurrentToken(), TokenInteger, "1")
+		require.Same(t, a, stream.CurrentToken())
+		require.Equal(t, TokenInteger, stream.CurrentToken().Key())
+		require.Equal(t, 1, stream.CurrentToken().Depth())
+		require.Equal(t, 6, stream.len)
+		require.Equal(t, []string{"f", "[", "1", ",", "b", ")"}, streamValues(stream.GoTo(0)))
+	})
+
+	t.Run("pending bracket", func(t *testing.T) {
+		for _, async := range []bool{false, true} {
+			stream := tokenizer.ParseStream(strings.NewReader("f(a, b, c, d) (e, f)"), 2)
+			if async {
+				stream.Async(1)
+			}
+			open := stream.Replace(stream.GoNext().CurrentToken(), parenOpen, "[")
+			open = stream.Replace(open, parenOpen, "{")
+			stream.GoTo(9)
+			require.Equal(t, ")", stream.CurrentToken().ValueString())
+			require.Same(t, open, stream.CurrentToken().Pair())
+			require.Same(t, stream.CurrentToken(), open.Pair())
+
+			stream.Remove(stream.GoNext().CurrentToken())
+			stream.GoTo(14)
+			require.Equal(t, ")", stream.CurrentToken().ValueString())
+			require.Same(t, undefToken, stream.CurrentToken().Pair())
+			stream.Close()
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		stream := tokenizer.ParseString("a<b<c>> >> d")
+		defer stream.Close()
+		stream.GoTo(5)
+		require.Equal(t, shiftKey, stream.CurrentToken().Key())
+		second := stream.Split(stream.CurrentToken(), 1)
+		require.Equal(t, greaterKey, stream.CurrentToken().Key())
+		require.Equal(t, greaterKey, second.Key())
+		require.Equal(t, 5, second.ID())
+		require.Equal(t, 6, second.Offset())
+		require.False(t, second.IsSynthetic())
+		require.Equal(t, undefToken, stream.Split(second, 1))
+
+		require.Equal(t, []TokenKey{greaterKey, greaterKey, shiftKey}, []TokenKey{
+			stream.CurrentToken().Key(), stream.PeekKey(1), stream.PeekKey(2),
+		})
+		_, err := stream.GoNext().GoNext().Expect(greaterKey)
+		require.EqualError(t, err, `1:9: syntax error: unexpected TShift ">>", expected TGreater`)
+		require.Equal(t, "1 | a<b<c>> >> d\n  |         ^~", err.(*SyntaxError).Snippet)
+		require.Equal(t, []int{0, 1, 2, 3, 4, 5, 5, 6, 7}, streamIDs(stream))
+
+		stream = New().AllowNumberSuffixes([]string{"ms"}).ParseString("10ms")
+		tail := stream.Split(stream.CurrentToken(), 1)
+		require.Equal(t, "0ms", tail.ValueString())
+		require.Equal(t, "ms", string(tail.NumberSuffix()))
+		require.Empty(t, stream.CurrentToken().NumberSuffix())
+		stream.Close()
+	})
+
+	var source strings.Builder
+	for i := 0; i < 100; i++ {
+		source.WriteString("a + (b + c) + d >> e\n")
+	}
+
+	// edit wraps each `+` into brackets, replaces `d` and splits each `>>`
+	edit := func(stream *Stream) []string {
+		var values []string
+		for ; stream.IsValid(); stream.GoNext() {
+			token := stream.CurrentToken()
+			switch token.Key() {
+			case plusKey:
+				stream.Remove(stream.InsertAfter(token, parenClose, ")"))
+				stream.InsertBefore(token, parenOpen, "(")
+				stream.InsertAfter(token, parenClose, ")")
+			case shiftKey:
+				stream.Split(token, 1)
+			case TokenKeyword:
+				if token.ValueString() == "d" {
+					stream.Replace(token, TokenInteger, "4")
+				}
+			}
+			values = append(values, stream.CurrentToken().ValueString())
+		}
+		return values
+	}
+	expected := edit(tokenizer.ParseString(source.String()))
+	require.Len(t, expected, 1500)
+
+	t.Run("stream", func(t *testing.T) {
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 8).SetHistorySize(4)
+		require.Equal(t, expected, edit(stream))
+		stream.Close()
+
+		stream = tokenizer.ParseStream(strings.NewReader(source.String()), 8).Async(2)
+		require.Equal(t, expected, edit(stream))
+		require.Equal(t, 1800, stream.len)
+		stream.Close()
+	})
+
+	t.Run("view", func(t *testing.T) {
+		stream := tokenizer.ParseString("f(a + b) c")
+		defer stream.Close()
+		stream.GoNext()
+		args, err := stream.SubStream(parenOpen, parenClose)
+		require.NoError(t, err)
+		require.Equal(t, 3, args.len)
+		args.Remove(args.CurrentToken())
+		args.InsertAfter(args.CurrentToken(), TokenInteger, "1")
+		require.Equal(t, 7, stream.len)
+		require.Equal(t, 3, args.len)
+		require.Equal(t, []string{"+", "1", "b"}, streamValues(args))
+		args.Close()
+		require.Equal(t, []string{"f", "(", "+", "1", "b", ")", "c"}, streamValues(stream.GoTo(0)))
+	})
+}
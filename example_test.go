@@ -28,6 +28,7 @@ func newJSONParser() *jsonParser {
 	parser := &jsonParser{}
 	parser.tokenizer = New()
 	parser.tokenizer.
+		NameKey(TokenColon, "TokenColon").
 		DefineTokens(TokenCurlyOpen, []string{"{"}).
 		DefineTokens(TokenCurlyClose, []string{"}"}).
 		DefineTokens(TokenSquareOpen, []string{"["}).
@@ -52,19 +53,18 @@ func (parser *jsonParser) analyzer(stream *Stream) (interface{}, error) {
 			if stream.CurrentToken().Is(TokenString) { // checks if token is quoted string, then it is object's key
 				var key = stream.CurrentToken().ValueUnescapedString()
 				var err error
-				if stream.GoNext().CurrentToken().Is(TokenColon) { // analyze key's value
-					if object[key], err = parser.analyzer(stream.GoNext()); err != nil {
-						return nil, err
-					}
-					if stream.CurrentToken().Is(TokenComma) {
-						stream.GoNext()
-						if stream.CurrentToken().Is(TokenCurlyClose) {
-							return nil, parser.error(stream)
-						}
-					} else if !stream.CurrentToken().Is(TokenCurlyClose) {
+				if _, err = stream.GoNext().Expect(TokenColon); err != nil {
+					return nil, err
+				}
+				if object[key], err = parser.analyzer(stream); err != nil { // analyze key's value
+					return nil, err
+				}
+				if stream.CurrentToken().Is(TokenComma) {
+					stream.GoNext()
+					if stream.CurrentToken().Is(TokenCurlyClose) {
 						return nil, parser.error(stream)
 					}
-				} else {
+				} else if !stream.CurrentToken().Is(TokenCurlyClose) {
 					return nil, parser.error(stream)
 				}
 			} else if stream.CurrentToken().Is(TokenCurlyClose) { // checks if token '}', then close the object
@@ -129,4 +129,7 @@ func TestJsonParser(t *testing.T) {
 		"two":  "three",
 		"four": []interface{}{int64(5), "six", 7.8, map[string]interface{}{}},
 	}, data)
+
+	_, err = parser.Parse([]byte("{\n\t\"one\": 1,\n\t\"two\" \"three\"\n}"))
+	require.EqualError(t, err, `3:8: syntax error: unexpected TokenString "\"three\"", expected TokenColon`)
 }
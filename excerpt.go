@@ -0,0 +1,264 @@
+package tokenizer
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// excerptTabWidth is the distance between tab stops in excerpts.
+const excerptTabWidth = 4
+
+// wideRunes contains ranges of East Asian wide and fullwidth characters which take two columns in terminals.
+var wideRunes = [][2]rune{
+	{0x1100, 0x115F}, // Hangul Jamo
+	{0x2E80, 0x303E}, // CJK radicals, punctuation
+	{0x3041, 0x33FF}, // Hiragana, Katakana, CJK compatibility
+	{0x3400, 0x4DBF}, // CJK extension A
+	{0x4E00, 0x9FFF}, // CJK unified ideographs
+	{0xA000, 0xA4CF}, // Yi
+	{0xAC00, 0xD7A3}, // Hangul syllables
+	{0xF900, 0xFAFF}, // CJK compatibility ideographs
+	{0xFE30, 0xFE4F}, // CJK compatibility forms
+	{0xFF00, 0xFF60}, // fullwidth forms
+	{0xFFE0, 0xFFE6},
+	{0x1F300, 0x1F64F}, // pictographs, emoticons
+	{0x1F900, 0x1F9FF},
+	{0x20000, 0x2FFFD},
+	{0x30000, 0x3FFFD},
+}
+
+// runeWidth returns count of terminal columns of the rune.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) { // combining marks and format characters
+		return 0
+	}
+	for _, w := range wideRunes {
+		if r < w[0] {
+			break
+		} else if r <= w[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// expandLine replaces tabs with spaces and returns the line with terminal columns of each byte of the source line.
+// The last column is the width of the line.
+func expandLine(line []byte) (string, []int) {
+	var (
+		text    = make([]byte, 0, len(line))
+		columns = make([]int, len(line)+1)
+		col     int
+	)
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		for j := 0; j < size; j++ {
+			columns[i+j] = col
+		}
+		if r == '\t' {
+			stop := (col/excerptTabWidth + 1) * excerptTabWidth
+			text = append(text, strings.Repeat(" ", stop-col)...)
+			col = stop
+		} else {
+			text = append(text, line[i:i+size]...)
+			col += runeWidth(r)
+		}
+		i += size
+	}
+	columns[len(line)] = col
+	return string(text), columns
+}
+
+// Excerpt returns lines of the source around the token: the line of the token and `context` lines before and after it.
+// Lines are prefixed with line numbers, the token is underlined:
+//
+//	 9 | a = 1;
+//	10 | b == "x";
+//	   |   ^~
+//
+// Tabs are expanded to spaces, wide unicode characters (like CJK) take two columns.
+// The source is reconstructed from tokens of the stream, in the infinite stream next data-chunks are parsed if needed.
+// Lines which are evicted from the history (see SetHistorySize) are cut.
+// Returns empty string if the token is not a token of the stream.
+func (s *Stream) Excerpt(token *Token, context int) string {
+	if token == nil || token == undefToken {
+		return ""
+	}
+	return s.ExcerptRange(token.offset, token.offset+len(token.value), context)
+}
+
+// ExcerptRange returns lines of the source around the range of bytes [from, to) like Excerpt.
+// Empty range is marked by the caret only.
+func (s *Stream) ExcerptRange(from, to, context int) string {
+	if context < 0 {
+		context = 0
+	}
+	if to < from {
+		to = from
+	}
+	anchor := s.tokenAt(from)
+	if anchor == nil {
+		return ""
+	}
+	// collect tokens around the range until there are enough lines before and after it
+	var (
+		first, last   = anchor, anchor
+		before, after = bytes.Count(anchor.indent, []byte{newLine}), 0
+	)
+	for before <= context && first.prev != nil {
+		first = first.prev
+		before += bytes.Count(first.indent, []byte{newLine}) + bytes.Count(first.value, []byte{newLine})
+	}
+	for next := s.successor(last); next != nil && last.offset+len(last.value) < to; next = s.successor(last) {
+		last = next
+	}
+	for next := s.successor(last); next != nil && after <= context; next = s.successor(last) {
+		last = next
+		after += bytes.Count(last.indent, []byte{newLine}) + bytes.Count(last.value, []byte{newLine})
+	}
+	source, base := sourceOf(first, last)
+	from, to = clamp(from-base, 0, len(source)), clamp(to-base, 0, len(source))
+	line := anchor.line - bytes.Count(source[:clamp(anchor.offset-base, 0, len(source))], []byte{newLine})
+
+	// split the source into lines and select lines around the range
+	type sourceLine struct {
+		number     int
+		start, end int
+	}
+	var lines []sourceLine
+	for start := 0; ; line++ {
+		end := bytes.IndexByte(source[start:], newLine)
+		if end == -1 {
+			lines = append(lines, sourceLine{line, start, len(source)})
+			break
+		}
+		lines = append(lines, sourceLine{line, start, start + end})
+		start += end + 1
+	}
+	// the last byte of the range or the position of the empty range
+	end := from
+	if to > from {
+		end = to - 1
+	}
+	fromLine, toLine := -1, -1
+	for i, l := range lines {
+		if fromLine == -1 && from <= l.end {
+			fromLine = i
+		}
+		if toLine == -1 && end <= l.end {
+			toLine = i
+		}
+	}
+	lo, hi := fromLine-context, toLine+context
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= len(lines) {
+		hi = len(lines) - 1
+	}
+
+	var (
+		gutter  = len(strconv.Itoa(lines[hi].number))
+		excerpt strings.Builder
+	)
+	for i := lo; i <= hi; i++ {
+		l := lines[i]
+		text, columns := expandLine(bytes.TrimSuffix(source[l.start:l.end], []byte{'\r'}))
+		if i > lo {
+			excerpt.WriteByte('\n')
+		}
+		number := strconv.Itoa(l.number)
+		excerpt.WriteString(strings.Repeat(" ", gutter-len(number)) + number + " | " + text)
+		if i < fromLine || i > toLine {
+			continue
+		}
+		// underline the part of the range on this line
+		start, stop := clamp(from-l.start, 0, len(columns)-1), clamp(to-l.start, 0, len(columns)-1)
+		if i > fromLine && stop <= start {
+			continue
+		}
+		mark := "~"
+		if i == fromLine {
+			mark = "^"
+		}
+		width := columns[stop] - columns[start]
+		if width < 1 {
+			width = 1
+		}
+		excerpt.WriteString("\n" + strings.Repeat(" ", gutter) + " | " + strings.Repeat(" ", columns[start]) +
+			mark + strings.Repeat("~", width-1))
+	}
+	return excerpt.String()
+}
+
+// sourceOf reconstructs the source from indents and values of tokens from the first token to the last one and returns
+// it with the offset of the source. Synthetic tokens (see Token.IsSynthetic) are not a part of the source,
+// removed tokens are replaced by spaces and line breaks.
+func sourceOf(first, last *Token) ([]byte, int) {
+	var (
+		source []byte
+		base   = -1
+		// the offset and the line of the end of the source
+		end, line int
+	)
+	for token := first; ; token = token.next {
+		if !token.IsSynthetic() {
+			start := token.offset - len(token.indent)
+			if base == -1 {
+				base, end = start, start
+				line = token.line - bytes.Count(token.indent, []byte{newLine})
+			}
+			if gap := start - end; gap > 0 {
+				breaks := clamp(token.line-bytes.Count(token.indent, []byte{newLine})-line, 0, gap)
+				source = append(source, strings.Repeat("\n", breaks)+strings.Repeat(" ", gap-breaks)...)
+			}
+			source = append(append(source, token.indent...), token.value...)
+			end = token.offset + len(token.value)
+			line = token.line + bytes.Count(token.value, []byte{newLine})
+		}
+		if token == last {
+			break
+		}
+	}
+	if base == -1 {
+		base = first.offset
+	}
+	return source, base
+}
+
+// tokenAt returns the token which contains the byte at the offset with its indent or the last token if the offset
+// is beyond the stream. Returns nil if the offset is before the head of the stream.
+func (s *Stream) tokenAt(offset int) *Token {
+	token := s.current
+	if token == nil || token == undefToken {
+		if s.prev != nil {
+			token = s.prev
+		} else if s.next != nil {
+			token = s.next
+		} else {
+			return nil
+		}
+	}
+	for token.offset-len(token.indent) > offset {
+		if token.prev == nil {
+			return nil
+		}
+		token = token.prev
+	}
+	for token.next != nil && token.next.offset-len(token.next.indent) <= offset {
+		token = token.next
+	}
+	return token
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	} else if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcerpt(t *testing.T) {
+	const quoteKey = TokenKey(10)
+	tokenizer := New()
+	tokenizer.DefineStringToken(quoteKey, `"`, `"`)
+	source := strings.Repeat("x\n", 8) + "a\tb = 中文 c\r\nd \"e\nf\" g\n\n"
+
+	for name, stream := range map[string]*Stream{
+		"bytes":  tokenizer.ParseString(source),
+		"stream": tokenizer.ParseStream(strings.NewReader(source), 4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			stream.GoTo(12)
+			require.Equal(t, "c", stream.CurrentToken().ValueString())
+			require.Equal(t, "9 | a   b = 中文 c\n"+
+				"  |              ^", stream.Excerpt(stream.CurrentToken(), 0))
+			require.Equal(t, " 8 | x\n"+
+				" 9 | a   b = 中文 c\n"+
+				"   |         ^~~~\n"+
+				"10 | d \"e", stream.Excerpt(stream.PrevToken(), 1))
+
+			stream.GoNext().GoNext()
+			require.Equal(t, "e\nf", strings.Trim(stream.CurrentToken().ValueString(), `"`))
+			require.Equal(t, "10 | d \"e\n"+
+				"   |   ^~\n"+
+				"11 | f\" g\n"+
+				"   | ~~", stream.Excerpt(stream.CurrentToken(), 0))
+
+			// range between tokens and the empty range
+			require.Equal(t, "9 | a   b = 中文 c\n"+
+				"  |  ^~~~", stream.ExcerptRange(17, 19, 0))
+			require.Equal(t, "10 | d \"e\n"+
+				"11 | f\" g\n"+
+				"   |     ^", stream.ExcerptRange(41, 41, 1))
+			require.Equal(t, "", stream.Excerpt(undefToken, 0))
+		})
+	}
+
+	t.Run("combining marks", func(t *testing.T) {
+		stream := tokenizer.ParseString("é x")
+		require.Equal(t, "1 | é x\n  |   ^", stream.ExcerptRange(4, 5, 0))
+	})
+
+	t.Run("evicted history", func(t *testing.T) {
+		stream := tokenizer.ParseStream(strings.NewReader(source), 4).SetHistorySize(2)
+		stream.GoTo(12)
+		require.Equal(t, "", stream.ExcerptRange(0, 1, 0))
+		require.Equal(t, "9 |  = 中文 c\n  |         ^", stream.Excerpt(stream.CurrentToken(), 0))
+	})
+}
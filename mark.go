@@ -0,0 +1,99 @@
+package tokenizer
+
+import "errors"
+
+var errReleasedMark = errors.New("tokenizer: rewind to released mark")
+
+// Mark is a checkpoint of the stream position, see Stream.Mark.
+type Mark struct {
+	current *Token
+	prev    *Token
+	next    *Token
+}
+
+// id returns ID of the token pinned by the mark or -1.
+func (m *Mark) id() int {
+	for _, token := range []*Token{m.current, m.prev, m.next} {
+		if token != nil && token != undefToken {
+			return token.id
+		}
+	}
+	return -1
+}
+
+// Mark saves the current position of the stream. The position may be restored by Rewind in O(1).
+// While the mark is live, the history (see SetHistorySize) keeps the marked token and all tokens after it.
+// The mark must be released by Release when backtracking is no longer needed.
+//
+//	mark := stream.Mark()
+//	if !parseAlternative(stream) {
+//		stream.Rewind(mark)
+//	}
+//	stream.Release(mark)
+func (s *Stream) Mark() *Mark {
+	m := &Mark{
+		current: s.current,
+		prev:    s.prev,
+		next:    s.next,
+	}
+	s.marks = append(s.marks, m)
+	if id := m.id(); id != -1 && (s.oldest == nil || id < s.oldest.id()) {
+		s.oldest = m
+	}
+	return m
+}
+
+// Rewind moves the pointer of the stream to the position saved by the mark.
+// The mark stays live. Rewind panics if the mark is released.
+func (s *Stream) Rewind(m *Mark) *Stream {
+	if !s.isLive(m) {
+		panic(errReleasedMark)
+	}
+	s.current = m.current
+	s.prev = m.prev
+	s.next = m.next
+	return s
+}
+
+// Release releases the mark, tokens pinned by the mark may be evicted from the history.
+// Release of the released mark does nothing.
+func (s *Stream) Release(m *Mark) {
+	for i, mark := range s.marks {
+		if mark == m {
+			s.marks = append(s.marks[:i], s.marks[i+1:]...)
+			if s.oldest == m {
+				s.findOldest()
+			}
+			return
+		}
+	}
+}
+
+// isLive checks if the mark belongs to the stream and is not released.
+func (s *Stream) isLive(m *Mark) bool {
+	for _, mark := range s.marks {
+		if mark == m {
+			return true
+		}
+	}
+	return false
+}
+
+// findOldest finds the live mark with the smallest ID of the token.
+func (s *Stream) findOldest() {
+	s.oldest = nil
+	for _, m := range s.marks {
+		if id := m.id(); id != -1 && (s.oldest == nil || id < s.oldest.id()) {
+			s.oldest = m
+		}
+	}
+}
+
+// pinned checks if the token is pinned by the oldest live mark.
+func (s *Stream) pinned(token *Token) bool {
+	if s.oldest == nil {
+		return false
+	}
+	id := s.oldest.id()
+	return id != -1 && id <= token.id
+}
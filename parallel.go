@@ -0,0 +1,276 @@
+package tokenizer
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+const (
+	// parallelMinSegment is the minimal size of the segment for parallel parsing.
+	parallelMinSegment = 256 << 10
+	// parallelSyncWindow is the size of the area at the beginning of the segment where resynchronization points are recorded.
+	parallelSyncWindow = 64 << 10
+)
+
+// parallelLayout sets sizes of segments for parallel parsing, see parallelMinSegment and parallelSyncWindow.
+type parallelLayout struct {
+	minSegment int
+	syncWindow int
+}
+
+// syncPoint is a position where the parser starts a token outside strings and injections.
+type syncPoint struct {
+	offset int
+	// count of tokens emitted before the point
+	n    int
+	line int
+	// key of the last token of ChannelDefault before the point
+	prior TokenKey
+}
+
+// segment is a part of the data parsed by one worker.
+type segment struct {
+	start int
+	// the parser stops at the first token which starts at or after the limit, 0 means no limit
+	limit int
+	// resynchronization points are recorded before the offset
+	window int
+	syncs  []syncPoint
+	// the parser reached the limit
+	limited bool
+	p       *parsing
+}
+
+// mark records the resynchronization point at the current position of the parser.
+// Returns true if the parser reached the limit of the segment.
+func (s *segment) mark(p *parsing) bool {
+	pos := p.offset + p.pos
+	if s.limit != 0 && pos >= s.limit {
+		s.limited = true
+		return true
+	}
+	if pos < s.window {
+		s.syncs = append(s.syncs, syncPoint{offset: pos, n: p.n, line: p.line, prior: p.prior})
+	}
+	return false
+}
+
+// find returns the resynchronization point at the offset.
+func (s *segment) find(offset int) (syncPoint, bool) {
+	i := sort.Search(len(s.syncs), func(i int) bool {
+		return s.syncs[i].offset >= offset
+	})
+	if i < len(s.syncs) && s.syncs[i].offset == offset {
+		return s.syncs[i], true
+	}
+	return syncPoint{}, false
+}
+
+// run parses the segment.
+func (s *segment) run(t *Tokenizer, str []byte) {
+	s.p = newParser(t, str[s.start:])
+	s.p.offset = s.start
+	s.p.segment = s
+	s.p.parse()
+}
+
+// ParseBytesParallel parses the slice of bytes like ParseBytes but uses up to `workers` goroutines.
+// If `workers` < 1 GOMAXPROCS is used.
+// The data is split into segments after newlines (or whitespaces); each segment is parsed speculatively
+// and then stitched with the previous one at the first token where both parsers agree.
+// If the segment can't be stitched (for example, it starts inside a framed string) it is parsed again sequentially,
+// so the stream is always identical to the stream of ParseBytes: keys, values, lines, offsets and IDs of tokens.
+// Small data is parsed sequentially.
+func (t *Tokenizer) ParseBytesParallel(str []byte, workers int) *Stream {
+	return t.parseParallel(str, workers, parallelLayout{minSegment: parallelMinSegment, syncWindow: parallelSyncWindow})
+}
+
+// parseParallel parses the slice of bytes in parallel with segments of the layout.
+func (t *Tokenizer) parseParallel(str []byte, workers int, layout parallelLayout) *Stream {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	bounds := t.splitSegments(str, workers, layout)
+	if len(bounds) < 2 {
+		return t.ParseBytes(str)
+	}
+	segments := make([]*segment, len(bounds))
+	var wg sync.WaitGroup
+	for i, start := range bounds {
+		seg := &segment{start: start}
+		if i > 0 {
+			seg.window = start + layout.syncWindow
+		}
+		if i+1 < len(bounds) {
+			seg.limit = bounds[i+1]
+		}
+		segments[i] = seg
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seg.run(t, str)
+		}()
+	}
+	wg.Wait()
+	return t.stitch(str, segments)
+}
+
+// splitSegments returns starts of segments: the first segment starts at 0, others start after a newline
+// or, if there is no newline nearby, after a whitespace within the sync window.
+func (t *Tokenizer) splitSegments(str []byte, workers int, layout parallelLayout) []int {
+	size := len(str) / workers
+	if size < layout.minSegment {
+		size = layout.minSegment
+	}
+	bounds := []int{0}
+	for pos := size; pos < len(str); pos += size {
+		if pos <= bounds[len(bounds)-1] {
+			continue
+		}
+		end := pos + size/2
+		if end > len(str) {
+			end = len(str)
+		}
+		next := bytes.IndexByte(str[pos:end], newLine)
+		if next == -1 {
+			end = pos + layout.syncWindow
+			if end > len(str) {
+				end = len(str)
+			}
+			for i := pos; i < end; i++ {
+				if t.classes[str[i]]&classSpace != 0 {
+					next = i - pos
+					break
+				}
+			}
+		}
+		if next == -1 {
+			// the segment continues to the next attempt
+			continue
+		}
+		if pos+next+1 >= len(str) {
+			break
+		}
+		bounds = append(bounds, pos+next+1)
+	}
+	return bounds
+}
+
+// stitch joins tokens of segments into one stream.
+func (t *Tokenizer) stitch(str []byte, segments []*segment) *Stream {
+	var (
+		head, tail  *Token
+		n           int
+		diagnostics []Diagnostic
+		fixups      sync.WaitGroup
+		prev        = segments[0]
+	)
+	head, tail, n = prev.p.head, prev.p.ptr, prev.p.n
+	diagnostics = append(diagnostics, prev.p.diagnostics...)
+	i := 1
+	for ; i < len(segments) && prev.limited; i++ {
+		var (
+			seg   = segments[i]
+			pp    = prev.p
+			pos   = pp.offset + pp.pos
+			point syncPoint
+			found bool
+		)
+		if seg.limit != 0 && pos >= seg.limit {
+			// the previous parser passed the whole segment, for example, inside a long string
+			t.freeTokens(seg.p.head)
+			continue
+		}
+		if pos < seg.window {
+			point, found = seg.find(pos)
+		}
+		if found && t.allowNumberSign && pp.isOperand(point.prior) != pp.isOperand(pp.prior) {
+			found = false
+		}
+		if !found {
+			// the segment can't be stitched, parse it again from the position where the previous parser stopped
+			t.freeTokens(seg.p.head)
+			seg = &segment{start: pos, limit: seg.limit}
+			seg.p = newParser(t, str[pos:])
+			seg.p.offset = pos
+			seg.p.segment = seg
+			seg.p.line = pp.line
+			seg.p.last = pp.last
+			seg.p.prior = pp.prior
+			seg.p.token.line = pp.line
+			seg.p.parse()
+			point = syncPoint{offset: pos, line: pp.line, prior: pp.prior}
+		}
+		p := seg.p
+		// drop tokens before the resynchronization point
+		first := p.head
+		for j := 0; j < point.n; j++ {
+			next := first.next
+			t.freeToken(first)
+			first = next
+		}
+		lines, ids := pp.line-point.line, n-point.n
+		if first != nil {
+			first.prev = nil
+			first.indent = pp.token.indent
+			if tail == nil {
+				head = first
+			} else {
+				tail.addNext(first)
+			}
+			tail = p.ptr
+			if lines != 0 || ids != 0 {
+				fixups.Add(1)
+				go func(token, last *Token, lines, ids int) {
+					defer fixups.Done()
+					for ; ; token = token.next {
+						token.line += lines
+						token.id += ids
+						if token == last {
+							break
+						}
+					}
+				}(first, p.ptr, lines, ids)
+			}
+		}
+		for _, d := range p.diagnostics {
+			if d.Offset >= point.offset {
+				d.Line += lines
+				diagnostics = append(diagnostics, d)
+			}
+		}
+		n += p.n - point.n
+		p.line += lines
+		prev = seg
+	}
+	// the parser stopped on unknown token, segments after it are not a part of the stream
+	for _, seg := range segments[i:] {
+		t.freeTokens(seg.p.head)
+	}
+	fixups.Wait()
+	if t.brackets != nil {
+		diagnostics = t.pairBrackets(head, diagnostics)
+	}
+	p := prev.p
+	s := &Stream{
+		t:           t,
+		head:        validateToken(head),
+		current:     validateToken(head),
+		len:         n,
+		wsTail:      p.tail,
+		parsed:      p.offset + p.pos,
+		diagnostics: diagnostics,
+	}
+	return s.skipHidden()
+}
+
+// freeTokens releases the chain of tokens to the pool.
+func (t *Tokenizer) freeTokens(token *Token) {
+	for token != nil {
+		next := token.next
+		t.freeToken(token)
+		token = next
+	}
+}
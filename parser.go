@@ -1,6 +1,8 @@
 package tokenizer
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"unicode"
 	"unicode/utf8"
@@ -21,6 +23,8 @@ type parsing struct {
 	token     *Token
 	head      *Token
 	ptr       *Token
+	last      TokenKey // key of the last emitted token, the token itself may be detached from the parser
+	prior     TokenKey // key of the last emitted token of ChannelDefault, see isOperand
 	tail      []byte
 	stopKeys  []*tokenRef
 	n         int // tokens id generator
@@ -28,6 +32,16 @@ type parsing struct {
 	offset    int
 	resume    bool
 	parsed    int
+	// problems found in the source
+	diagnostics []Diagnostic
+	// segment of the data for parallel parsing, see ParseBytesParallel
+	segment *segment
+	// open brackets which wait for close ones, see Tokenizer.DefineBrackets
+	brackets []bracketFrame
+	// emitted tokens are consumed by another goroutine, see Stream.Async
+	detached bool
+	// start tokens of strings are not in the byte classification table, see Tokenizer.reclassified
+	reclassified bool
 }
 
 // newParser creates new parser for string
@@ -60,14 +74,11 @@ func newInfParser(t *Tokenizer, reader io.Reader, bufferSize uint) *parsing {
 }
 
 func (p *parsing) ensureBytes(n int) bool {
-	if p.pos+n >= len(p.str) {
-		if p.reader != nil {
-			p.loadChunk()
-			if p.pos+n < len(p.str) {
-				return true
-			}
+	for p.pos+n >= len(p.str) {
+		// reader may return less data than requested
+		if p.reader == nil || p.loadChunk() == 0 {
+			return false
 		}
-		return false
 	}
 	return true
 }
@@ -83,6 +94,31 @@ func (p *parsing) next() {
 	p.curr = p.str[p.pos]
 }
 
+// seek moves the pointer to the position.
+func (p *parsing) seek(pos int) {
+	p.pos = pos - 1
+	p.next()
+}
+
+// runeAt returns the rune at the position or utf8.RuneError if there is no data.
+func (p *parsing) runeAt(pos int) rune {
+	p.ensureBytes(pos - p.pos + 4)
+	if pos >= len(p.str) {
+		return utf8.RuneError
+	}
+	r, _ := utf8.DecodeRune(p.slice(pos, pos+4))
+	return r
+}
+
+// diagnose adds a problem at the current position.
+func (p *parsing) diagnose(message string) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Line:    p.line,
+		Offset:  p.offset + p.pos,
+		Message: message,
+	})
+}
+
 func (p *parsing) nextByte() byte {
 	if p.ensureBytes(1) {
 		return p.str[p.pos+1]
@@ -99,10 +135,7 @@ func (p *parsing) slice(from, to int) []byte {
 
 func (p *parsing) preload() {
 	n, err := p.reader.Read(p.str)
-	if n < p.chunkSize {
-		p.str = p.str[:n]
-		p.reader = nil
-	}
+	p.str = p.str[:n]
 	if err != nil {
 		p.reader = nil
 		if err != io.EOF {
@@ -112,17 +145,15 @@ func (p *parsing) preload() {
 }
 
 func (p *parsing) loadChunk() int {
-	// chunk size = new chunk size + size of tail of prev chunk
-	chunk := make([]byte, len(p.str)+p.chunkSize)
-	copy(chunk, p.str)
-	n, err := p.reader.Read(chunk[len(p.str):])
-
-	if n < p.chunkSize {
-		p.str = chunk[:len(p.str)+n]
-		p.reader = nil
-	} else {
-		p.str = chunk
+	chunk := p.str
+	if cap(chunk) == len(chunk) {
+		// chunk size = new chunk size + size of tail of prev chunk
+		chunk = make([]byte, len(p.str), len(p.str)+p.chunkSize)
+		copy(chunk, p.str)
 	}
+	// tokens don't refer to the free space of the chunk, so it may be filled
+	n, err := p.reader.Read(chunk[len(chunk):cap(chunk)])
+	p.str = chunk[:len(chunk)+n]
 
 	if err != nil {
 		p.reader = nil
@@ -157,10 +188,11 @@ func (p *parsing) parse() {
 	}
 	p.curr = p.str[p.pos]
 	p.resume = true
+	p.reclassified = p.t.reclassified()
 	for p.checkPoint() {
 		if p.stopKeys != nil {
 			for _, t := range p.stopKeys {
-				if p.ptr.key == t.Key {
+				if p.last == t.Key {
 					return
 				}
 			}
@@ -169,26 +201,33 @@ func (p *parsing) parse() {
 		if p.curr == 0 {
 			break
 		}
-		if p.parseToken() {
-			continue
-		}
-		if p.curr == 0 {
+		if p.segment != nil && p.stopKeys == nil && p.segment.mark(p) {
 			break
 		}
-		if p.parseKeyword() {
-			continue
+		class := p.t.classes[p.curr]
+		if p.reclassified {
+			class |= classString
 		}
-		if p.curr == 0 {
-			break
-		}
-		if p.parseNumber() {
-			continue
-		}
-		if p.curr == 0 {
-			break
-		}
-		if p.parseQuote() {
-			continue
+		if p.t.categories != nil {
+			if p.parseByPriority(class) {
+				continue
+			}
+		} else {
+			if class&classSign != 0 && p.parseNumber() {
+				continue
+			}
+			if class&classToken != 0 && p.parseToken() {
+				continue
+			}
+			if class&(classKeyword|classMultiByte) != 0 && p.parseKeyword() {
+				continue
+			}
+			if class&classNumber != 0 && p.parseNumber() {
+				continue
+			}
+			if class&classString != 0 && p.parseQuote() {
+				continue
+			}
 		}
 		if p.curr == 0 {
 			break
@@ -210,21 +249,27 @@ func (p *parsing) parse() {
 	}
 }
 
-func (p *parsing) parseWhitespace() bool {
-	var start = -1
-	for p.curr != 0 {
-		var matched = false
-		for _, ws := range p.t.wSpaces {
-			if p.curr == ws {
-				if start == -1 {
-					start = p.pos
-				}
-				matched = true
-				break
+// parseNext parses data until new tokens appear or the data ends.
+// Returns count of new tokens.
+func (p *parsing) parseNext() int {
+	n := p.n
+	for {
+		parsed := p.parsed + p.pos
+		p.parse()
+		if p.n != n || p.parsed+p.pos == parsed {
+			if p.n == n && p.reader == nil {
+				p.closeBrackets()
 			}
+			return p.n - n
 		}
-		if !matched {
-			break
+	}
+}
+
+func (p *parsing) parseWhitespace() bool {
+	var start = -1
+	for p.t.classes[p.curr]&classSpace != 0 {
+		if start == -1 {
+			start = p.pos
 		}
 		if p.curr == newLine {
 			p.line++
@@ -240,8 +285,33 @@ func (p *parsing) parseWhitespace() bool {
 }
 
 func (p *parsing) parseKeyword() bool {
+	start := p.scanKeyword()
+	if start == -1 {
+		return false
+	}
+	p.token.key = TokenKeyword
+	p.token.value = p.str[start:p.pos]
+	p.token.offset = p.offset + start
+	p.emmitToken()
+	return true
+}
+
+// scanKeyword moves the pointer to the end of the keyword.
+// Returns start of the keyword or -1 if there is no keyword at the current position.
+func (p *parsing) scanKeyword() int {
 	var start = -1
 	for p.curr != 0 {
+		if p.curr < utf8.RuneSelf { // fast path for ASCII
+			class := p.t.classes[p.curr]
+			if class&classKeyword == 0 && (start == -1 || class&classKeywordTail == 0) {
+				break
+			}
+			if start == -1 {
+				start = p.pos
+			}
+			p.next()
+			continue
+		}
 		var r rune
 		var size int
 		p.ensureBytes(4)
@@ -256,24 +326,56 @@ func (p *parsing) parseKeyword() bool {
 		}
 		p.next()
 	}
-	if start != -1 {
-		p.token.key = TokenKeyword
-		p.token.value = p.str[start:p.pos]
-		p.token.offset = p.offset + start
-		p.emmitToken()
-		return true
-	}
-	return false
+	return start
 }
 
 func (p *parsing) parseNumber() bool {
+	start, floatTraitPos := p.scanNumber()
+	if start == -1 {
+		return false
+	}
+	if floatTraitPos == -1 || floatTraitPos > p.pos-1 {
+		p.token.key = TokenInteger
+	} else {
+		p.token.key = TokenFloat
+	}
+	p.token.offset = p.offset + start
+	p.token.format = p.t.numberFormat
+	if p.t.numberSuffixes != nil || p.t.rejectUnknownSuffixes {
+		p.token.suffix = p.parseNumberSuffix()
+	}
+	p.token.value = p.str[start:p.pos]
+	p.emmitToken()
+	return true
+}
+
+// scanNumber moves the pointer to the end of the number without suffix.
+// Returns start of the number and position of the decimal separator or exponent (-1 if none).
+// If there is no number at the current position, start is -1 and the pointer is not moved.
+func (p *parsing) scanNumber() (int, int) {
+	var pos = p.pos
 	var start = -1
 	var end = -1
 	var floatTraitPos = -1
 	var hasPoint = false
 	var hasNumber = false
 	var hasExp = false
+	var decimal = byte('.')
+	var groups []byte
+	if p.t.numberFormat != nil {
+		decimal = p.t.numberFormat.DecimalSeparator
+		groups = p.t.numberFormat.GroupSeparators
+	}
+	// custom decimal separator must be between digits
+	var strict = decimal != '.'
 
+	if p.curr == '-' || p.curr == '+' {
+		if !p.t.allowNumberSign || p.isOperand(p.prior) || !p.isNumberNext() {
+			return -1, -1
+		}
+		start = p.pos
+		p.next()
+	}
 	for p.curr != 0 {
 		if isNumberByte(p.curr) {
 			if start == -1 {
@@ -283,23 +385,30 @@ func (p *parsing) parseNumber() bool {
 			hasNumber = true
 		} else {
 			nextByte := p.nextByte()
-			if p.curr == '_' {
-				if !hasNumber || (!p.t.allowNumberUnderscore || !isNumberByte(nextByte)) {
-					break
-				}
-			} else if p.curr == '.' {
+			if p.curr == decimal {
 				if hasPoint {
 					break
 				} else if isNumberByte(nextByte) {
 					if start == -1 { // floats can be started from a pointer
+						if strict {
+							break
+						}
 						start = p.pos
 					}
-				} else if !(nextByte == 'e' || nextByte == 'E' || nextByte == 0) {
+				} else if strict || !(nextByte == 'e' || nextByte == 'E' || nextByte == 0) {
 					break
 				}
 				floatTraitPos = p.pos
 				end = p.pos
 				hasPoint = true
+			} else if bytes.IndexByte(groups, p.curr) != -1 {
+				if !hasNumber || hasPoint || !isNumberByte(nextByte) {
+					break
+				}
+			} else if p.curr == '_' {
+				if !hasNumber || (!p.t.allowNumberUnderscore || !isNumberByte(nextByte)) {
+					break
+				}
 			} else if p.curr == 'e' || p.curr == 'E' {
 				if !hasNumber || !(isNumberByte(nextByte) || nextByte == '-' || nextByte == '+') || hasExp {
 					break
@@ -322,20 +431,76 @@ func (p *parsing) parseNumber() bool {
 		p.next()
 	}
 	if start == -1 {
+		p.seek(pos)
+		return -1, -1
+	}
+	p.seek(end + 1)
+	return start, floatTraitPos
+}
+
+// isNumberNext checks if the number starts from the next byte: `1` or `.1`.
+func (p *parsing) isNumberNext() bool {
+	if !p.ensureBytes(1) {
 		return false
 	}
-	end = end + 1
-	p.pos = end
-	p.token.value = p.str[start:end]
-	if floatTraitPos == -1 || floatTraitPos > end-1 {
-		p.token.key = TokenInteger
-		p.token.offset = p.offset + start
-	} else {
-		p.token.key = TokenFloat
-		p.token.offset = p.offset + start
+	next := p.str[p.pos+1]
+	if next == '.' && p.t.decimalSeparator() == '.' && p.ensureBytes(2) {
+		next = p.str[p.pos+2]
 	}
-	p.emmitToken()
-	return true
+	return isNumberByte(next)
+}
+
+// isOperand checks if the token with the key may be left operand of the binary operator.
+func (p *parsing) isOperand(key TokenKey) bool {
+	switch key {
+	case TokenInteger, TokenFloat, TokenKeyword, TokenString, TokenStringFragment:
+		return true
+	}
+	for _, k := range p.t.operandKeys {
+		if key == k {
+			return true
+		}
+	}
+	return p.t.isCloseBracket(key)
+}
+
+// parseNumberSuffix captures allowed suffix right after the number.
+// Returns length of the suffix.
+func (p *parsing) parseNumberSuffix() int {
+	if n := p.matchNumberSuffix(); n > 0 {
+		p.seek(p.pos + n)
+		return n
+	}
+	if p.t.rejectUnknownSuffixes && p.curr != 0 {
+		if r := p.runeAt(p.pos); unicode.IsLetter(r) || runeExists(p.t.kwMajorSymbols, r) {
+			var word []rune
+			for pos := p.pos; p.isWordRune(r); r = p.runeAt(pos) {
+				word = append(word, r)
+				pos += utf8.RuneLen(r)
+			}
+			p.diagnose(fmt.Sprintf("unknown number suffix %q", string(word)))
+		}
+	}
+	return 0
+}
+
+// matchNumberSuffix returns length of the allowed suffix at the current position or 0.
+func (p *parsing) matchNumberSuffix() int {
+	if p.curr == 0 {
+		return 0
+	}
+	for _, suffix := range p.t.numberSuffixes {
+		if p.match(suffix, false) && !p.isWordRune(p.runeAt(p.pos+len(suffix))) {
+			return len(suffix)
+		}
+	}
+	return 0
+}
+
+// isWordRune checks if the rune may continue a keyword or a number.
+func (p *parsing) isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) ||
+		runeExists(p.t.kwMajorSymbols, r) || runeExists(p.t.kwMinorSymbols, r)
 }
 
 // match compares next bytes from data with `r`
@@ -367,56 +532,43 @@ func (p *parsing) match(r []byte, seek bool) bool {
 
 // parseQuote parses quoted string.
 func (p *parsing) parseQuote() bool {
-	var quote *StringSettings
 	var start = p.pos
-	for _, q := range p.t.quotes {
-		if p.match(q.StartToken, true) {
-			quote = q
-			break
-		}
-	}
+	quote := p.matchQuote()
 	if quote == nil {
 		return false
 	}
+	fast, endLines := quote.fresh(), quote.endLines
+	if fast {
+		p.line += quote.startLines
+	} else {
+		p.line += bytes.Count(quote.StartToken, []byte{newLine})
+		endLines = bytes.Count(quote.EndToken, []byte{newLine})
+	}
+	p.seek(p.pos + len(quote.StartToken))
 	p.token.key = TokenString
 	p.token.offset = p.offset + start
 	p.token.string = quote
 	escapes := false
 	for p.curr != 0 {
+		if fast && !escapes && !quote.stops[p.curr] {
+			// fast path: skip bytes which can't be escape symbol, end of the string, injection or new line
+			end := p.pos + 1
+			for end < len(p.str) && !quote.stops[p.str[end]] {
+				end++
+			}
+			p.seek(end)
+			continue
+		}
 		if escapes {
 			escapes = false
 		} else if p.curr == quote.EscapeSymbol {
 			escapes = true
-		} else if p.match(quote.EndToken, true) {
+		} else if len(quote.EndToken) > 0 && p.match(quote.EndToken, true) {
+			p.line += endLines
 			break
-		} else if quote.Injects != nil {
-			loop := true
-			for _, inject := range quote.Injects {
-				for _, token := range p.t.tokens[inject.StartKey] {
-					if p.match(token.Token, true) {
-						p.token.key = TokenStringFragment
-						p.token.value = p.str[start : p.pos-len(token.Token)]
-						p.emmitToken()
-						p.token.key = token.Key
-						p.token.value = token.Token
-						p.token.offset = p.offset + p.pos - len(token.Token)
-						p.emmitToken()
-						stopKeys := p.stopKeys // may be recursive quotes
-						p.stopKeys = p.t.tokens[inject.EndKey]
-						p.parse()
-						p.stopKeys = stopKeys
-						p.token.key = TokenStringFragment
-						p.token.offset = p.offset + p.pos
-						p.token.string = quote
-						start = p.pos
-						loop = false
-						break
-					}
-				}
-				if !loop {
-					break
-				}
-			}
+		} else if quote.Injects != nil && p.parseInjection(quote, start) {
+			start = p.pos
+			continue
 		}
 		if p.curr == newLine {
 			p.line++
@@ -428,26 +580,89 @@ func (p *parsing) parseQuote() bool {
 	return true
 }
 
-// parseToken search any rune sequence from tokenItem.
-func (p *parsing) parseToken() bool {
-	if p.curr != 0 {
-		toks := p.t.index[p.curr]
-		if toks != nil {
-			start := p.pos
-			for _, t := range toks {
-				if p.match(t.Token, true) {
-					p.token.key = t.Key
-					p.token.offset = p.offset + start
-					p.token.value = t.Token
-					p.emmitToken()
-					return true
+// matchQuote returns settings of the framed string which starts at the current position or nil.
+func (p *parsing) matchQuote() *StringSettings {
+	for _, q := range p.t.quotes {
+		if len(q.StartToken) > 0 && p.match(q.StartToken, false) {
+			return q
+		}
+	}
+	return nil
+}
+
+// parseInjection parses injection if it starts at the current position of the framed string.
+// The fragment of the string before injection starts from `start`.
+func (p *parsing) parseInjection(quote *StringSettings, start int) bool {
+	for _, inject := range quote.Injects {
+		for _, token := range p.t.tokens[inject.StartKey] {
+			if p.match(token.Token, true) {
+				p.token.key = TokenStringFragment
+				p.token.value = p.str[start : p.pos-len(token.Token)]
+				p.emmitToken()
+				p.token.key = token.Key
+				p.token.value = token.Token
+				p.token.offset = p.offset + p.pos - len(token.Token)
+				p.token.flags = flagInjectionStart
+				p.emmitToken()
+				stopKeys := p.stopKeys // may be recursive quotes
+				p.stopKeys = p.t.tokens[inject.EndKey]
+				p.parse()
+				// parse stops after loading of the next data-chunk, but the injection continues
+				for !p.resume && p.curr != 0 && p.last != inject.EndKey {
+					p.parse()
+				}
+				p.stopKeys = stopKeys
+				if p.ptr != nil && p.last == inject.EndKey {
+					p.ptr.flags |= flagInjectionEnd
 				}
+				p.token.key = TokenStringFragment
+				p.token.offset = p.offset + p.pos
+				p.token.string = quote
+				return true
 			}
 		}
 	}
 	return false
 }
 
+// parseToken searches the longest user defined token via the prefix tree.
+func (p *parsing) parseToken() bool {
+	found := p.matchToken()
+	if found == nil {
+		return false
+	}
+	p.token.key = found.Key
+	p.token.offset = p.offset + p.pos
+	p.token.value = found.Token
+	p.seek(p.pos + len(found.Token))
+	p.emmitToken()
+	return true
+}
+
+// matchToken returns the longest user defined token at the current position or nil.
+func (p *parsing) matchToken() *tokenRef {
+	if p.curr == 0 {
+		return nil
+	}
+	node := p.t.trie.root[p.curr]
+	if node == nil {
+		return nil
+	}
+	var found *tokenRef
+	for i := 1; ; i++ {
+		if node.ref != nil {
+			found = node.ref
+		}
+		if len(node.labels) == 0 || !p.ensureBytes(i) {
+			break
+		}
+		if node = node.child(p.str[p.pos+i]); node == nil {
+			break
+		}
+	}
+	return found
+}
+
 // emmitToken add new p.token to stream
 func (p *parsing) emmitToken() {
 	if p.ptr == nil {
@@ -457,6 +672,16 @@ func (p *parsing) emmitToken() {
 		p.ptr.addNext(p.token)
 		p.ptr = p.token
 	}
+	p.last = p.token.key
+	if p.t.channels != nil {
+		p.token.channel = p.t.channelOf(p.token)
+	}
+	if p.token.channel == ChannelDefault {
+		p.prior = p.token.key
+	}
+	if p.t.brackets != nil && p.segment == nil {
+		p.pairBracket(p.token)
+	}
 	p.n++
 	p.token = p.t.allocToken()
 	p.token.id = p.n
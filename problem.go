@@ -0,0 +1,232 @@
+package tokenizer
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ProblemLevel is the severity of the configuration problem.
+type ProblemLevel int
+
+const (
+	// ProblemWarning means that the configuration works, but some definitions are ambiguous or shadowed.
+	ProblemWarning ProblemLevel = iota
+	// ProblemError means that the configuration is invalid. Compile rejects such configuration.
+	ProblemError
+)
+
+func (l ProblemLevel) String() string {
+	if l == ProblemError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Problem describes a problem of the tokenizer configuration, see Tokenizer.Validate.
+type Problem struct {
+	Level ProblemLevel
+	// Key of the offending definition
+	Key TokenKey
+	// Token is the offending token or start token of the string, if any
+	Token string
+	// Message describes the problem.
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Level.String() + ": " + p.Message
+}
+
+// rejection is the definition ignored by the method of the tokenizer.
+type rejection struct {
+	// name of the method, like DefineTokens
+	method string
+	Problem
+}
+
+// reject records the definition ignored by the method.
+// The next definition of the key by the method replaces the rejected one, see retract.
+func (t *Tokenizer) reject(method string, problem Problem) {
+	t.retract(method, problem.Key)
+	t.rejected = append(t.rejected, rejection{method: method, Problem: problem})
+}
+
+// retract forgets definitions of the key ignored by the method.
+func (t *Tokenizer) retract(method string, key TokenKey) {
+	rejected := t.rejected[:0:0]
+	for _, r := range t.rejected {
+		if r.method != method || r.Key != key {
+			rejected = append(rejected, r)
+		}
+	}
+	t.rejected = rejected
+}
+
+// Validate checks the configuration and returns all found problems:
+//   - invalid definitions, like tokens with key < 1 or strings without end token (errors);
+//   - tokens which shadow numbers, like `.` for `.5`, or shadow keywords, like `in` for `index`;
+//   - tokens which shadow framed strings, like `"` or `/` for `//`;
+//   - unreachable definitions: the same token for several keys or the same start token for several strings.
+//
+// The configuration with errors can't be compiled, see Compile.
+func (t *Tokenizer) Validate() []Problem {
+	var problems []Problem
+	for _, r := range t.rejected {
+		problems = append(problems, r.Problem)
+	}
+	problems = append(problems, t.validateStrings()...)
+	problems = append(problems, t.validateNumberFormat()...)
+	problems = append(problems, t.validateTokens()...)
+	problems = append(problems, t.validateBrackets()...)
+	return problems
+}
+
+func (t *Tokenizer) validateStrings() []Problem {
+	var problems []Problem
+	for i, q := range t.quotes {
+		if len(q.StartToken) == 0 {
+			problems = append(problems, Problem{
+				Level:   ProblemError,
+				Key:     q.Key,
+				Message: fmt.Sprintf("string %s: empty start token", t.KeyName(q.Key)),
+			})
+		}
+		if len(q.EndToken) == 0 {
+			problems = append(problems, Problem{
+				Level:   ProblemError,
+				Key:     q.Key,
+				Token:   string(q.StartToken),
+				Message: fmt.Sprintf("string %s: empty end token", t.KeyName(q.Key)),
+			})
+		}
+		for _, inject := range q.Injects {
+			if len(t.tokens[inject.StartKey]) == 0 {
+				problems = append(problems, Problem{
+					Level:   ProblemError,
+					Key:     q.Key,
+					Token:   string(q.StartToken),
+					Message: fmt.Sprintf("string %s: injection start key %s is not defined", t.KeyName(q.Key), t.KeyName(inject.StartKey)),
+				})
+			}
+			if len(t.tokens[inject.EndKey]) == 0 {
+				problems = append(problems, Problem{
+					Level:   ProblemError,
+					Key:     q.Key,
+					Token:   string(q.StartToken),
+					Message: fmt.Sprintf("string %s: injection end key %s is not defined", t.KeyName(q.Key), t.KeyName(inject.EndKey)),
+				})
+			}
+		}
+		for _, prev := range t.quotes[:i] {
+			if bytes.Equal(prev.StartToken, q.StartToken) {
+				problems = append(problems, Problem{
+					Level:   ProblemWarning,
+					Key:     q.Key,
+					Token:   string(q.StartToken),
+					Message: fmt.Sprintf("string %s is unreachable: string %s has the same start token %q", t.KeyName(q.Key), t.KeyName(prev.Key), q.StartToken),
+				})
+				break
+			}
+		}
+	}
+	return problems
+}
+
+func (t *Tokenizer) validateNumberFormat() []Problem {
+	f := t.numberFormat
+	if f == nil {
+		return nil
+	}
+	if isNumberByte(f.DecimalSeparator) || f.DecimalSeparator == 0 {
+		return []Problem{{
+			Level:   ProblemError,
+			Message: fmt.Sprintf("invalid decimal separator %q", f.DecimalSeparator),
+		}}
+	}
+	for _, g := range f.GroupSeparators {
+		if g == f.DecimalSeparator || isNumberByte(g) || g == 0 {
+			return []Problem{{
+				Level:   ProblemError,
+				Message: fmt.Sprintf("invalid group separator %q", g),
+			}}
+		}
+	}
+	return nil
+}
+
+func (t *Tokenizer) validateTokens() []Problem {
+	var (
+		problems []Problem
+		// the first key of each token
+		owners = map[string]TokenKey{}
+	)
+	for _, key := range t.keys {
+		for _, ref := range t.tokens[key] {
+			token := string(ref.Token)
+			warn := func(format string, args ...interface{}) {
+				problems = append(problems, Problem{
+					Level:   ProblemWarning,
+					Key:     key,
+					Token:   token,
+					Message: fmt.Sprintf("token %q of key %s ", token, t.KeyName(key)) + fmt.Sprintf(format, args...),
+				})
+			}
+			if owner, exists := owners[token]; exists {
+				if owner == key {
+					warn("is duplicated")
+				} else {
+					warn("is unreachable: key %s has the same token", t.KeyName(owner))
+				}
+				continue
+			}
+			owners[token] = key
+			first := ref.Token[0]
+			class := t.classes[first]
+			// in maximal munch mode the longer match wins, so the token shadows only equal matches
+			if t.shadowsNumbers(ref.Token) && !t.maximalMunch && t.precedes(CategoryToken, CategoryNumber) {
+				warn("shadows numbers which start with %q", first)
+			}
+			if class&classKeyword != 0 && !t.maximalMunch && t.precedes(CategoryToken, CategoryKeyword) {
+				warn("shadows keywords which start with %q", token)
+			}
+			if !t.precedes(CategoryToken, CategoryString) {
+				continue
+			}
+			for i, q := range t.quotes {
+				if len(q.StartToken) == 0 || hasStartToken(t.quotes[:i], q.StartToken) {
+					// the string is invalid or unreachable anyway, see validateStrings
+					continue
+				}
+				if t.maximalMunch {
+					if bytes.Equal(q.StartToken, ref.Token) {
+						warn("makes string %s unreachable: start token %q is the same", t.KeyName(q.Key), q.StartToken)
+					}
+				} else if bytes.HasPrefix(q.StartToken, ref.Token) {
+					warn("makes string %s unreachable: start token %q begins with the token", t.KeyName(q.Key), q.StartToken)
+				} else if bytes.HasPrefix(ref.Token, q.StartToken) {
+					warn("shadows string %s which starts with %q", t.KeyName(q.Key), q.StartToken)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// shadowsNumbers checks if the token matches the beginning of a number: the token starts with a digit,
+// or it is the decimal point alone or followed by a digit, like `.` or `.5` but not `...`.
+func (t *Tokenizer) shadowsNumbers(token []byte) bool {
+	if t.classes[token[0]]&classNumber == 0 {
+		return false
+	}
+	return isNumberByte(token[0]) || len(token) == 1 || isNumberByte(token[1])
+}
+
+// hasStartToken checks if any of the strings starts with the start token.
+func hasStartToken(quotes []*StringSettings, start []byte) bool {
+	for _, q := range quotes {
+		if bytes.Equal(q.StartToken, start) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Spec is a declarative specification of the tokenizer, which may be stored as JSON.
+// Spec covers everything the builder API covers.
+//
+//	{
+//	  "whitespaces": " \t\n",
+//	  "keywordSymbols": {"major": "_", "minor": "0123456789"},
+//	  "numbers": {"underscore": true, "suffixes": ["ms", "s"]},
+//	  "tokens": [
+//	    {"key": 1, "name": "TOpen", "values": ["{"]},
+//	    {"key": 2, "values": ["}"]}
+//	  ],
+//	  "strings": [
+//	    {"key": 3, "start": "\"", "end": "\"", "escape": "\\", "specials": ["n", "t"], "injections": [{"start": 1, "end": 2}]}
+//	  ]
+//	}
+type Spec struct {
+	// Whitespaces are bytes of whitespace symbols. If omitted DefaultWhiteSpaces are used.
+	Whitespaces *string `json:"whitespaces,omitempty"`
+	// KeywordSymbols are additional symbols of keywords, see Tokenizer.AllowKeywordSymbols.
+	KeywordSymbols *KeywordSymbolsSpec `json:"keywordSymbols,omitempty"`
+	// StopOnUnknown stops parsing on unknown token, see Tokenizer.StopOnUndefinedToken.
+	StopOnUnknown bool `json:"stopOnUnknown,omitempty"`
+	// Numbers describes options of numbers.
+	Numbers *NumberSpec `json:"numbers,omitempty"`
+	// Tokens are custom tokens, see Tokenizer.DefineTokens.
+	Tokens []TokenSpec `json:"tokens,omitempty"`
+	// Strings are framed strings, see Tokenizer.DefineStringToken.
+	Strings []StringSpec `json:"strings,omitempty"`
+	// Priority is the order of categories: "token", "keyword", "number", "string". See Tokenizer.SetPriority.
+	Priority []string `json:"priority,omitempty"`
+	// MaximalMunch enables maximal munch mode, see Tokenizer.UseMaximalMunch.
+	MaximalMunch bool `json:"maximalMunch,omitempty"`
+	// Brackets are pairs of keys of tokens, see Tokenizer.DefineBrackets.
+	Brackets []BracketSpec `json:"brackets,omitempty"`
+	// Channels assign keys of tokens to channels, see Tokenizer.SetChannel.
+	Channels []ChannelSpec `json:"channels,omitempty"`
+}
+
+// KeywordSymbolsSpec describes major and minor symbols of keywords as strings of runes.
+type KeywordSymbolsSpec struct {
+	Major string `json:"major,omitempty"`
+	Minor string `json:"minor,omitempty"`
+}
+
+// NumberSpec describes options of numbers.
+type NumberSpec struct {
+	// Underscore allows underscore in numbers, see Tokenizer.AllowNumberUnderscore.
+	Underscore bool `json:"underscore,omitempty"`
+	// Signed allows signed numbers, see Tokenizer.AllowSignedNumbers.
+	Signed bool `json:"signed,omitempty"`
+	// OperandKeys are keys of tokens after which a sign is not a part of a number.
+	OperandKeys []TokenKey `json:"operandKeys,omitempty"`
+	// Suffixes are allowed number suffixes, see Tokenizer.AllowNumberSuffixes.
+	Suffixes []string `json:"suffixes,omitempty"`
+	// RejectUnknownSuffixes reports unknown suffixes, see Tokenizer.RejectUnknownNumberSuffixes.
+	RejectUnknownSuffixes bool `json:"rejectUnknownSuffixes,omitempty"`
+	// DecimalSeparator is one byte decimal separator, see Tokenizer.SetNumberFormat.
+	DecimalSeparator string `json:"decimalSeparator,omitempty"`
+	// GroupSeparators are bytes of group separators, see Tokenizer.SetNumberFormat.
+	GroupSeparators string `json:"groupSeparators,omitempty"`
+}
+
+// TokenSpec describes custom tokens of the key.
+type TokenSpec struct {
+	Key TokenKey `json:"key"`
+	// Name is the name of the key for debug output, see Tokenizer.NameKey.
+	Name   string   `json:"name,omitempty"`
+	Values []string `json:"values"`
+}
+
+// StringSpec describes framed string.
+type StringSpec struct {
+	Key TokenKey `json:"key"`
+	// Name is the name of the key for debug output, see Tokenizer.NameKey.
+	Name  string `json:"name,omitempty"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Escape is one byte escape symbol.
+	Escape     string          `json:"escape,omitempty"`
+	Specials   []string        `json:"specials,omitempty"`
+	Injections []InjectionSpec `json:"injections,omitempty"`
+}
+
+// InjectionSpec describes keys of tokens which open and close injection in the framed string.
+type InjectionSpec struct {
+	Start TokenKey `json:"start"`
+	End   TokenKey `json:"end"`
+}
+
+// BracketSpec describes keys of tokens which open and close brackets.
+type BracketSpec struct {
+	Open  TokenKey `json:"open"`
+	Close TokenKey `json:"close"`
+}
+
+// ChannelSpec describes keys of tokens of the channel.
+type ChannelSpec struct {
+	Channel Channel    `json:"channel"`
+	Keys    []TokenKey `json:"keys"`
+}
+
+// SpecError is a validation error of the spec.
+// Path points to the offending value, like `tokens[2].values[0]`.
+type SpecError struct {
+	Path    string
+	Message string
+}
+
+func (e *SpecError) Error() string {
+	if e.Path == "" {
+		return "spec: " + e.Message
+	}
+	return "spec: " + e.Path + ": " + e.Message
+}
+
+func specError(path, format string, args ...interface{}) *SpecError {
+	return &SpecError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// specCheck returns the first error of the configuration (see Tokenizer.Validate) as *SpecError of the path.
+// The configuration is checked after each part of the spec, so the error belongs to the last applied part.
+func specCheck(t *Tokenizer, path string) error {
+	if err := t.validate(); err != nil {
+		return specError(path, "%s", err)
+	}
+	return nil
+}
+
+// LoadSpec reads JSON spec from the reader and creates configured tokenizer.
+// The reader must contain the only JSON object.
+// Errors of the spec are *SpecError.
+func LoadSpec(r io.Reader) (*Tokenizer, error) {
+	var spec Spec
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, specError("", "%s", err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return nil, specError("", "unexpected data after the spec")
+	}
+	return NewFromSpec(&spec)
+}
+
+// NewFromSpec validates the spec and creates configured tokenizer.
+// Definitions are validated like Tokenizer.Validate does, warnings are ignored.
+// Errors of the spec are *SpecError.
+func NewFromSpec(spec *Spec) (*Tokenizer, error) {
+	t := New()
+	if spec.Whitespaces != nil {
+		t.SetWhiteSpaces([]byte(*spec.Whitespaces))
+	}
+	if ks := spec.KeywordSymbols; ks != nil {
+		t.AllowKeywordSymbols([]rune(ks.Major), []rune(ks.Minor))
+	}
+	if spec.StopOnUnknown {
+		t.StopOnUndefinedToken()
+	}
+	if n := spec.Numbers; n != nil {
+		if n.Underscore {
+			t.AllowNumberUnderscore()
+		}
+		if n.Signed {
+			t.AllowSignedNumbers(n.OperandKeys...)
+		} else if len(n.OperandKeys) > 0 {
+			return nil, specError("numbers.operandKeys", "operand keys require signed numbers")
+		}
+		for i, suffix := range n.Suffixes {
+			if suffix == "" {
+				return nil, specError(fmt.Sprintf("numbers.suffixes[%d]", i), "empty suffix")
+			}
+		}
+		t.AllowNumberSuffixes(n.Suffixes)
+		if n.RejectUnknownSuffixes {
+			t.RejectUnknownNumberSuffixes()
+		}
+		if n.DecimalSeparator != "" || n.GroupSeparators != "" {
+			decimal := byte('.')
+			if n.DecimalSeparator != "" {
+				if len(n.DecimalSeparator) != 1 {
+					return nil, specError("numbers.decimalSeparator", "decimal separator must be one byte, got %q", n.DecimalSeparator)
+				}
+				decimal = n.DecimalSeparator[0]
+			}
+			t.SetNumberFormat(decimal, []byte(n.GroupSeparators))
+		}
+		if err := specCheck(t, "numbers"); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Priority != nil {
+		categories := make([]Category, len(spec.Priority))
+		for i, name := range spec.Priority {
+			for c, n := range categoryNames {
+				if n == name {
+					categories[i] = c
+				}
+			}
+			if categories[i] == 0 {
+				return nil, specError(fmt.Sprintf("priority[%d]", i), "unknown category %q", name)
+			}
+		}
+		t.SetPriority(categories...)
+	}
+	if spec.MaximalMunch {
+		t.UseMaximalMunch()
+	}
+	defined := map[TokenKey]int{}
+	for i, ts := range spec.Tokens {
+		path := fmt.Sprintf("tokens[%d]", i)
+		if j, exists := defined[ts.Key]; exists {
+			return nil, specError(path+".key", "key %s is already defined at tokens[%d]", t.KeyName(ts.Key), j)
+		}
+		if len(ts.Values) == 0 {
+			return nil, specError(path+".values", "no tokens")
+		}
+		for j, v := range ts.Values {
+			if v == "" {
+				return nil, specError(fmt.Sprintf("%s.values[%d]", path, j), "empty token")
+			}
+		}
+		defined[ts.Key] = i
+		t.DefineTokens(ts.Key, ts.Values)
+		if err := specCheck(t, path); err != nil {
+			return nil, err
+		}
+		t.NameKey(ts.Key, ts.Name)
+	}
+	for i, ss := range spec.Strings {
+		path := fmt.Sprintf("strings[%d]", i)
+		if ss.Key < 1 {
+			return nil, specError(path+".key", "key must be positive, got %d", ss.Key)
+		}
+		if len(ss.Escape) > 1 {
+			return nil, specError(path+".escape", "escape must be one byte, got %q", ss.Escape)
+		}
+		if ss.Name != "" {
+			t.NameKey(ss.Key, ss.Name)
+		}
+		q := t.DefineStringToken(ss.Key, ss.Start, ss.End)
+		if ss.Escape != "" {
+			q.SetEscapeSymbol(ss.Escape[0])
+		}
+		for j, special := range ss.Specials {
+			if special == "" {
+				return nil, specError(fmt.Sprintf("%s.specials[%d]", path, j), "empty special string")
+			}
+		}
+		q.AddSpecialStrings(ss.Specials)
+		for _, inject := range ss.Injections {
+			q.AddInjection(inject.Start, inject.End)
+		}
+		if err := specCheck(t, path); err != nil {
+			return nil, err
+		}
+	}
+	for i, bs := range spec.Brackets {
+		t.DefineBrackets(bs.Open, bs.Close)
+		if err := specCheck(t, fmt.Sprintf("brackets[%d]", i)); err != nil {
+			return nil, err
+		}
+	}
+	for i, cs := range spec.Channels {
+		path := fmt.Sprintf("channels[%d]", i)
+		if len(cs.Keys) == 0 {
+			return nil, specError(path+".keys", "no keys")
+		}
+		t.SetChannel(cs.Channel, cs.Keys...)
+		if err := specCheck(t, path); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Spec returns declarative specification of the tokenizer configuration.
+func (t *Tokenizer) Spec() *Spec {
+	spec := &Spec{
+		StopOnUnknown: t.stopOnUnknown,
+	}
+	if !bytes.Equal(t.wSpaces, DefaultWhiteSpaces) {
+		ws := string(t.wSpaces)
+		spec.Whitespaces = &ws
+	}
+	if len(t.kwMajorSymbols) > 0 || len(t.kwMinorSymbols) > 0 {
+		spec.KeywordSymbols = &KeywordSymbolsSpec{
+			Major: string(t.kwMajorSymbols),
+			Minor: string(t.kwMinorSymbols),
+		}
+	}
+	n := NumberSpec{
+		Underscore:            t.allowNumberUnderscore,
+		Signed:                t.allowNumberSign,
+		OperandKeys:           t.operandKeys,
+		RejectUnknownSuffixes: t.rejectUnknownSuffixes,
+	}
+	for _, suffix := range t.numberSuffixes {
+		n.Suffixes = append(n.Suffixes, string(suffix))
+	}
+	if t.numberFormat != nil {
+		n.DecimalSeparator = string([]byte{t.numberFormat.DecimalSeparator})
+		n.GroupSeparators = string(t.numberFormat.GroupSeparators)
+	}
+	if n.Underscore || n.Signed || n.RejectUnknownSuffixes || n.Suffixes != nil || n.DecimalSeparator != "" {
+		spec.Numbers = &n
+	}
+	for _, c := range t.categories {
+		spec.Priority = append(spec.Priority, c.String())
+	}
+	spec.MaximalMunch = t.maximalMunch
+	for _, key := range t.keys {
+		spec.Tokens = append(spec.Tokens, TokenSpec{Key: key, Name: t.names[key], Values: t.Tokens(key)})
+	}
+	for _, q := range t.quotes {
+		ss := StringSpec{
+			Key:   q.Key,
+			Name:  t.names[q.Key],
+			Start: string(q.StartToken),
+			End:   string(q.EndToken),
+		}
+		if q.EscapeSymbol != 0 {
+			ss.Escape = string([]byte{q.EscapeSymbol})
+		}
+		for _, special := range q.SpecSymbols {
+			ss.Specials = append(ss.Specials, string(special))
+		}
+		for _, inject := range q.Injects {
+			ss.Injections = append(ss.Injections, InjectionSpec{Start: inject.StartKey, End: inject.EndKey})
+		}
+		spec.Strings = append(spec.Strings, ss)
+	}
+	for _, pair := range t.brackets {
+		spec.Brackets = append(spec.Brackets, BracketSpec{Open: pair.Open, Close: pair.Close})
+	}
+	for channel := ChannelDefault; channel <= MaxChannel; channel++ {
+		cs := ChannelSpec{Channel: channel}
+		for key, c := range t.channels {
+			if c == channel {
+				cs.Keys = append(cs.Keys, key)
+			}
+		}
+		if len(cs.Keys) > 0 {
+			sort.Slice(cs.Keys, func(i, j int) bool { return cs.Keys[i] < cs.Keys[j] })
+			spec.Channels = append(spec.Channels, cs)
+		}
+	}
+	return spec
+}
+
+// MarshalSpec returns the spec of the tokenizer as JSON. See LoadSpec.
+func (t *Tokenizer) MarshalSpec() ([]byte, error) {
+	return json.MarshalIndent(t.Spec(), "", "  ")
+}
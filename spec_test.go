@@ -0,0 +1,113 @@
+package tokenizer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSpec(t *testing.T) {
+	openKey := TokenKey(10)
+	closeKey := TokenKey(11)
+	plusKey := TokenKey(12)
+	quoteKey := TokenKey(13)
+	spec := `{
+		"whitespaces": " \n",
+		"keywordSymbols": {"major": "_", "minor": "0123456789"},
+		"numbers": {"underscore": true, "signed": true, "operandKeys": [11], "suffixes": ["ms"]},
+		"tokens": [
+			{"key": 10, "values": ["{"]},
+			{"key": 11, "values": ["}"]},
+			{"key": 12, "values": ["+"]}
+		],
+		"strings": [
+			{"key": 13, "start": "\"", "end": "\"", "escape": "\\", "specials": ["n"], "injections": [{"start": 10, "end": 11}]}
+		]
+	}`
+	tokenizer, err := LoadSpec(strings.NewReader(spec))
+	require.NoError(t, err)
+
+	stream := tokenizer.ParseString("-1_000ms a_1 \"x{y}\\n\" {b} +2")
+	require.Equal(t, []TokenKey{
+		TokenInteger, TokenKeyword,
+		TokenStringFragment, openKey, TokenKeyword, closeKey, TokenStringFragment,
+		openKey, TokenKeyword, closeKey, plusKey, TokenInteger,
+	}, streamKeys(stream))
+	require.Equal(t, quoteKey, tokenizer.Strings()[0].Key)
+	require.Equal(t, []string{"-1_000ms", "a_1", "\"x", "{", "y", "}", "\\n\"", "{", "b", "}", "+", "2"},
+		streamValues(tokenizer.ParseString("-1_000ms a_1 \"x{y}\\n\" {b} +2")))
+	require.Equal(t, "\t", string(tokenizer.ParseString("a\tb").GoNext().CurrentToken().Value()))
+}
+
+func TestMarshalSpec(t *testing.T) {
+	tokenizer := New()
+	tokenizer.SetWhiteSpaces([]byte(" \t"))
+	tokenizer.AllowKeywordSymbols(Underscore, nil)
+	tokenizer.StopOnUndefinedToken()
+	tokenizer.AllowSignedNumbers(1)
+	tokenizer.AllowNumberSuffixes([]string{"px", "em"})
+	tokenizer.RejectUnknownNumberSuffixes()
+	tokenizer.SetNumberFormat(',', []byte("."))
+	tokenizer.DefineTokens(1, []string{")"})
+	tokenizer.DefineTokens(2, []string{"(", "(("})
+	tokenizer.DefineTokens(4, []string{})
+	tokenizer.DefineBrackets(2, 1)
+	tokenizer.SetChannel(ChannelHidden, TokenKeyword, 3).SetChannel(5, 1)
+	tokenizer.NameKey(1, "TClose").NameKey(3, "TQuote")
+	tokenizer.SetPriority(CategoryString).UseMaximalMunch()
+	tokenizer.DefineStringToken(3, `'`, `'`).SetEscapeSymbol('\'').AddSpecialStrings([]string{"'"}).AddInjection(2, 1)
+
+	data, err := tokenizer.MarshalSpec()
+	require.NoError(t, err)
+	loaded, err := LoadSpec(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	again, err := loaded.MarshalSpec()
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), string(again))
+	require.Equal(t, tokenizer.Spec(), loaded.Spec())
+
+	source := "(1.000,5px) 'a(b)''' -2em"
+	require.Equal(t, streamValues(tokenizer.ParseString(source)), streamValues(loaded.ParseString(source)))
+
+	data, err = New().MarshalSpec()
+	require.NoError(t, err)
+	require.JSONEq(t, `{}`, string(data))
+}
+
+func TestSpecErrors(t *testing.T) {
+	cases := []struct {
+		spec string
+		path string
+		err  string
+	}{
+		{`{"tokens": [{"key": 1, "values": ["a"]}, {"key": 2, "values": ["b", ""]}]}`, "tokens[1].values[1]", "spec: tokens[1].values[1]: empty token"},
+		{`{"tokens": [{"key": 0, "values": ["a"]}]}`, "tokens[0]", "spec: tokens[0]: tokens of key TokenUndef are ignored: key must be positive"},
+		{`{"tokens": [{"key": 1, "values": ["a"]}, {"key": 1, "values": ["b"]}]}`, "tokens[1].key", "spec: tokens[1].key: key TokenKey(1) is already defined at tokens[0]"},
+		{`{"tokens": [{"key": 1, "values": []}]}`, "tokens[0].values", "spec: tokens[0].values: no tokens"},
+		{`{"strings": [{"key": 1, "start": "", "end": "'"}]}`, "strings[0]", "spec: strings[0]: string TokenKey(1) is ignored: empty start token"},
+		{`{"strings": [{"key": 1, "start": "'", "end": ""}]}`, "strings[0]", "spec: strings[0]: string TokenKey(1): empty end token"},
+		{`{"strings": [{"key": 1, "start": "'", "end": "'", "escape": "ab"}]}`, "strings[0].escape", "spec: strings[0].escape: escape must be one byte, got \"ab\""},
+		{`{"strings": [{"key": 1, "start": "'", "end": "'", "injections": [{"start": 5, "end": 6}]}]}`, "strings[0]", "spec: strings[0]: string TokenKey(1): injection start key TokenKey(5) is not defined"},
+		{`{"numbers": {"decimalSeparator": "1"}}`, "numbers", "spec: numbers: invalid decimal separator '1'"},
+		{`{"numbers": {"decimalSeparator": ",,"}}`, "numbers.decimalSeparator", "spec: numbers.decimalSeparator: decimal separator must be one byte, got \",,\""},
+		{`{"numbers": {"operandKeys": [1]}}`, "numbers.operandKeys", "spec: numbers.operandKeys: operand keys require signed numbers"},
+		{`{"numbers": {"suffixes": ["ms", ""]}}`, "numbers.suffixes[1]", "spec: numbers.suffixes[1]: empty suffix"},
+		{`{"priority": ["number", "word"]}`, "priority[1]", "spec: priority[1]: unknown category \"word\""},
+		{`{"tokens": [{"key": 1, "values": ["("]}], "brackets": [{"open": 1, "close": 2}]}`, "brackets[0]", "spec: brackets[0]: bracket key TokenKey(2) is not defined"},
+		{`{"tokens": [{"key": 1, "values": ["("]}], "brackets": [{"open": 1, "close": 1}]}`, "brackets[0]", "spec: brackets[0]: brackets TokenKey(1) and TokenKey(1) are ignored: keys must be positive and different"},
+		{`{"channels": [{"channel": 64, "keys": [1]}]}`, "channels[0]", "spec: channels[0]: channel 64 is ignored: channel must be less than or equal to 63"},
+		{`{"channels": [{"channel": 1, "keys": []}]}`, "channels[0].keys", "spec: channels[0].keys: no keys"},
+		{`{"token": []}`, "", "spec: json: unknown field \"token\""},
+		{`{} {}`, "", "spec: unexpected data after the spec"},
+		{`{}}`, "", "spec: unexpected data after the spec"},
+	}
+	for _, c := range cases {
+		_, err := LoadSpec(strings.NewReader(c.spec))
+		require.EqualError(t, err, c.err, c.spec)
+		var specErr *SpecError
+		require.True(t, errors.As(err, &specErr), c.spec)
+		require.Equal(t, c.path, specErr.Path, c.spec)
+	}
+}
@@ -24,6 +24,23 @@ type Stream struct {
 	wsTail []byte
 	// count of parsed bytes
 	parsed int
+	// problems found by the parser
+	diagnostics []Diagnostic
+	// error of the reader in async mode
+	err error
+	// background lexer, see Async
+	async *asyncLexer
+	// live marks, see Mark
+	marks []*Mark
+	// the live mark with the smallest ID of the token, it pins the history, see pinned
+	oldest *Mark
+	// the stream of the view and the mark which pins tokens of the view in it, see SubStream
+	parent     *Stream
+	parentMark *Mark
+	// the view contains tokens between these tokens (exclusive), nil for regular streams
+	lower, upper *Token
+	// mask of visible channels, 0 means ChannelDefault only, see UseChannels
+	channels uint64
 
 	p           *parsing
 	historySize int
@@ -38,35 +55,51 @@ func validateToken(t *Token) *Token {
 
 // NewStream creates a new parsed stream of tokens.
 func NewStream(p *parsing) *Stream {
-	return &Stream{
+	s := &Stream{
 		t:       p.t,
 		head:    validateToken(p.head),
 		current: validateToken(p.head),
 		len:     p.n,
 		wsTail:  p.tail,
 		parsed:  p.parsed + p.pos,
+
+		diagnostics: p.diagnostics,
 	}
+	return s.skipHidden()
 }
 
 // NewInfStream creates new stream with active parser.
 func NewInfStream(p *parsing) *Stream {
-	return &Stream{
+	s := &Stream{
 		t:       p.t,
 		p:       p,
 		len:     p.n,
 		head:    validateToken(p.head),
 		current: validateToken(p.head),
 	}
+	return s.skipHidden()
 }
 
-// SetHistorySize sets the number of tokens that should remain after the current token
+// SetHistorySize sets the number of tokens that should remain after the current token.
+// Views (see SubStream) don't own tokens, so the history size of views is ignored.
 func (s *Stream) SetHistorySize(size int) *Stream {
-	s.historySize = size
+	if s.parent == nil {
+		s.historySize = size
+	}
 	return s
 }
 
-// Close releases all token objects to pool
+// Close releases all token objects to pool.
+// Close of the view (see SubStream) releases tokens of the view in the parent stream only.
 func (s *Stream) Close() {
+	if s.parent != nil {
+		s.parent.Release(s.parentMark)
+		s.parent, s.parentMark = nil, nil
+		s.head = nil
+	}
+	if s.async != nil {
+		s.async.cancel()
+	}
 	for ptr := s.head; ptr != nil && ptr != undefToken; {
 		p := ptr.next
 		s.t.freeToken(ptr)
@@ -74,6 +107,8 @@ func (s *Stream) Close() {
 	}
 	s.next = nil
 	s.prev = nil
+	s.marks = nil
+	s.oldest = nil
 	s.head = undefToken
 	s.current = undefToken
 	s.len = 0
@@ -82,9 +117,9 @@ func (s *Stream) Close() {
 func (s *Stream) String() string {
 	items := make([]string, 0, s.len)
 	ptr := s.head
-	for ptr != nil {
+	for ptr != nil && ptr != undefToken {
 		items = append(items, strconv.Itoa(ptr.id)+": "+ptr.String())
-		ptr = ptr.next
+		ptr = s.nextOf(ptr)
 	}
 
 	return strings.Join(items, "\n")
@@ -99,42 +134,89 @@ func (s *Stream) GetParsedLength() int {
 	}
 }
 
+// Diagnostics returns problems found by the parser, like unknown number suffixes.
+// For infinite stream diagnostics are collected as data is parsed.
+func (s *Stream) Diagnostics() []Diagnostic {
+	if s.p != nil {
+		return s.p.diagnostics
+	}
+	return s.diagnostics
+}
+
+// Err returns the error of the reader if reading of the infinite stream failed (io.EOF is not an error).
+// Tokens parsed before the error remain available.
+func (s *Stream) Err() error {
+	if s.p != nil {
+		return s.p.err
+	}
+	return s.err
+}
+
 // GoNext moves the stream pointer to the next token.
 // If there is no token, it initiates the parsing of the next chunk of data.
 // If there is no data, the pointer will point to the TokenUndef token.
+// Tokens of hidden channels are skipped, see UseChannels.
 func (s *Stream) GoNext() *Stream {
-	if s.current.next != nil {
-		s.current = s.current.next
-		if s.current.next == nil && s.p != nil { // lazy load and parse next data-chunk
-			n := s.p.n
-			s.p.parse()
-			s.len += s.p.n - n
-		}
-		if s.historySize != 0 && s.current.id-s.head.id > s.historySize {
-			t := s.head
-			s.head = s.head.unlink()
-			s.t.freeToken(t)
-			s.len--
+	if s.current == undefToken {
+		if s.next != nil { // we at the beginning of the stream
+			s.current = s.next
+			s.next = nil
 		}
-	} else if s.current == undefToken {
-		s.current = s.prev
-		s.prev = nil
-	} else {
+		return s
+	}
+	next := s.following(s.current)
+	if next == undefToken {
 		s.prev = s.current
 		s.current = undefToken
+		return s
+	}
+	s.current = next
+	if s.nextOf(s.current) == nil { // lazy load and parse next data-chunk
+		s.len += s.load()
+	}
+	// tokens after the oldest live mark are pinned, see Mark
+	for s.historySize != 0 && s.current.id-s.head.id > s.historySize && !s.pinned(s.head) {
+		t := s.head
+		s.head = s.head.unlink()
+		s.release(t)
+		s.len--
 	}
 	return s
 }
 
+// release releases the token which is removed from the stream to the pool.
+func (s *Stream) release(token *Token) {
+	// the open bracket which is not closed yet is referenced by the parser, the GC collects it
+	if token.pair != nil || !s.t.isOpenBracket(token.key) {
+		s.t.freeToken(token)
+	}
+}
+
+// load parses the next data-chunk of the infinite stream and returns count of new tokens.
+func (s *Stream) load() int {
+	if s.async != nil {
+		return s.receive()
+	}
+	if s.p != nil {
+		return s.p.parseNext()
+	}
+	return 0
+}
+
 // GoPrev moves the pointer of stream to the next token.
 // The number of possible calls is limited if you specified SetHistorySize.
 // If the beginning of the stream or the end of the history is reached, the pointer will point to the TokenUndef token.
+// Tokens of hidden channels are skipped, see UseChannels.
 func (s *Stream) GoPrev() *Stream {
-	if s.current.prev != nil {
-		s.current = s.current.prev
-	} else if s.current == undefToken {
-		s.current = s.next
-		s.prev = nil
+	if s.current == undefToken {
+		if s.prev != nil { // we at the end of the stream
+			s.current = s.prev
+			s.prev = nil
+		}
+		return s
+	}
+	if prev := s.preceding(s.current); prev != undefToken {
+		s.current = prev
 	} else {
 		s.next = s.current
 		s.current = undefToken
@@ -143,28 +225,35 @@ func (s *Stream) GoPrev() *Stream {
 }
 
 // GoTo moves the pointer of stream to specific token.
+// If the token is hidden (see UseChannels) or doesn't exist, the pointer stops at the nearest visible token
+// in the direction of moving or, if there is no such token, at the nearest visible token in the other direction.
+// Synthetic tokens (see InsertBefore, InsertAfter and Split) have the ID of the anchor token,
+// so IDs are not unique: GoTo stops at the first token with the ID, use GoNext to reach the following ones.
 func (s *Stream) GoTo(id int) *Stream {
 	if s.current == undefToken {
 		if s.prev != nil && id <= s.prev.id { // we at the end of the stream
 			s.GoPrev() // now current is available
-			for s.current != nil && id != s.current.id {
-				s.GoPrev()
-			}
-		} else if s.next != nil && id >= s.prev.id { // we at the beginning of the stream
+		} else if s.next != nil && id >= s.next.id { // we at the beginning of the stream
 			s.GoNext() // now current is available
-			for s.current != nil && id != s.current.id {
-				s.GoNext()
-			}
 		}
-		return s
 	}
 	if id > s.current.id {
-		for s.current != nil && id != s.current.id {
+		for s.IsValid() && id > s.current.id {
 			s.GoNext()
 		}
-	} else if id < s.current.id {
-		for s.current != nil && id != s.current.id {
+	} else {
+		for s.IsValid() && id < s.current.id {
+			s.GoPrev()
+		}
+		for s.IsValid() && s.PrevToken().id == id { // stop at the first token with the ID
+			s.GoPrev()
+		}
+	}
+	if s.current == undefToken { // step back from the end or the beginning of the stream
+		if s.prev != nil {
 			s.GoPrev()
+		} else {
+			s.GoNext()
 		}
 	}
 	return s
@@ -178,61 +267,110 @@ func (s *Stream) IsValid() bool {
 
 // IsNextSequence checks if these are next tokens in exactly the same sequence as specified.
 func (s *Stream) IsNextSequence(keys ...TokenKey) bool {
-	var (
-		result = true
-		hSize  = 0
-	)
-	if s.historySize > 0 && s.historySize < len(keys) {
-		hSize = s.historySize
-		s.historySize = len(keys)
-	}
-
-	start := s.current
+	token := s.current
 	for _, key := range keys {
-		if !s.GoNext().CurrentToken().Is(key) {
-			result = false
-			break
+		if token = s.following(token); !token.Is(key) {
+			return false
 		}
 	}
-	s.current = start
-
-	if hSize != 0 {
-		s.SetHistorySize(hSize)
-	}
-	return result
+	return true
 }
 
 // IsAnyNextSequence checks that at least one token from each group is contained in a sequence of tokens
 func (s *Stream) IsAnyNextSequence(keys ...[]TokenKey) bool {
-	var (
-		result = true
-		hSize  = 0
-	)
-	if s.historySize > 0 && s.historySize < len(keys) {
-		hSize = s.historySize
-		s.historySize = len(keys)
-	}
-
-	start := s.current
-	for _, key := range keys {
+	token := s.current
+	for _, group := range keys {
+		token = s.following(token)
 		found := false
-		for _, k := range key {
-			if s.GoNext().CurrentToken().Is(k) {
+		for _, k := range group {
+			if token.Is(k) {
 				found = true
 				break
 			}
 		}
 		if !found {
-			result = false
+			return false
+		}
+	}
+	return true
+}
+
+// Peek returns the n-th token after (n > 0) or before (n < 0) the current token without moving the pointer.
+// Peek(0) returns the current token. In the infinite stream Peek parses next data-chunks if needed.
+// If the token doesn't exist (or is evicted from the history), the method returns TokenUndef token.
+// Do not save a result (Token) into variables — the token may be changed at any time.
+func (s *Stream) Peek(n int) *Token {
+	token := s.current
+	for ; n > 0; n-- {
+		if token = s.following(token); token == undefToken {
 			break
 		}
 	}
-	s.current = start
+	for ; n < 0; n++ {
+		if token = s.preceding(token); token == undefToken {
+			break
+		}
+	}
+	return token
+}
+
+// PeekKey returns the key of the n-th token after (n > 0) or before (n < 0) the current token, see Peek.
+func (s *Stream) PeekKey(n int) TokenKey {
+	return s.Peek(n).key
+}
+
+// following returns the visible token after the token, parsing next data-chunk if needed, or TokenUndef token.
+func (s *Stream) following(token *Token) *Token {
+	if token == undefToken {
+		if token == s.current && s.next != nil { // we at the beginning of the stream
+			return s.next
+		}
+		return undefToken
+	}
+	for token = s.successor(token); token != nil && !s.visible(token); token = s.successor(token) {
+	}
+	return validateToken(token)
+}
+
+// preceding returns the visible token before the token or TokenUndef token.
+func (s *Stream) preceding(token *Token) *Token {
+	if token == undefToken {
+		if token == s.current && s.prev != nil { // we at the end of the stream
+			return s.prev
+		}
+		return undefToken
+	}
+	for token = s.prevOf(token); token != nil && !s.visible(token); token = s.prevOf(token) {
+	}
+	return validateToken(token)
+}
+
+// successor returns the token (of any channel) after the token, parsing next data-chunk if needed, or nil.
+func (s *Stream) successor(token *Token) *Token {
+	for s.nextOf(token) == nil {
+		n := s.load()
+		if n == 0 {
+			return nil
+		}
+		s.len += n
+	}
+	return s.nextOf(token)
+}
 
-	if hSize != 0 {
-		s.SetHistorySize(hSize)
+// nextOf returns the token after the token within the stream (or the view) or nil.
+func (s *Stream) nextOf(token *Token) *Token {
+	if token.next == s.upper {
+		return nil
 	}
-	return result
+	return token.next
+}
+
+// prevOf returns the token before the token within the stream (or the view) or nil.
+func (s *Stream) prevOf(token *Token) *Token {
+	if token.prev == s.lower {
+		return nil
+	}
+	return token.prev
 }
 
 // HeadToken returns the pointer to head-token.
@@ -252,20 +390,20 @@ func (s *Stream) CurrentToken() *Token {
 // If the previous token doesn't exist, the method returns TypeUndef token.
 // Do not save a result (Token) into variables — the previous token may be changed at any time.
 func (s *Stream) PrevToken() *Token {
-	if s.current.prev != nil {
-		return s.current.prev
+	if s.current == undefToken {
+		return undefToken
 	}
-	return undefToken
+	return s.preceding(s.current)
 }
 
-// NextToken returns next token from the stream.
+// NextToken returns next token from the stream, parsing next data-chunk if needed.
 // If next token doesn't exist, the method returns TypeUndef token.
 // Do not save a result (Token) into variables — the next token may be changed at any time.
 func (s *Stream) NextToken() *Token {
-	if s.current.next != nil {
-		return s.current.next
+	if s.current == undefToken {
+		return undefToken
 	}
-	return undefToken
+	return s.following(s.current)
 }
 
 // GoNextIfNextIs moves the stream pointer to the next token if the next token has specific token keys.
@@ -316,6 +454,13 @@ func (s *Stream) GetSnippet(before, after int) []Token {
 			offset: ptr.offset,
 			indent: ptr.indent,
 			string: ptr.string,
+			suffix: ptr.suffix,
+			format: ptr.format,
+
+			tokenizer: ptr.tokenizer,
+			flags:     ptr.flags,
+			depth:     ptr.depth,
+			channel:   ptr.channel,
 		}
 		if before <= 0 {
 			break
@@ -330,6 +475,13 @@ func (s *Stream) GetSnippet(before, after int) []Token {
 			offset: p.offset,
 			indent: p.indent,
 			string: p.string,
+			suffix: p.suffix,
+			format: p.format,
+
+			tokenizer: p.tokenizer,
+			flags:     p.flags,
+			depth:     p.depth,
+			channel:   p.channel,
 		}
 		if i >= after {
 			break
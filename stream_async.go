@@ -0,0 +1,132 @@
+package tokenizer
+
+import "sync"
+
+// tokenBatch is a chain of tokens lexed by the producer goroutine.
+type tokenBatch struct {
+	head *Token
+	tail *Token
+	// count of tokens in the chain
+	n int
+	// count of parsed bytes after the chain
+	parsed      int
+	diagnostics []Diagnostic
+	err         error
+}
+
+// asyncLexer delivers batches of tokens from the producer goroutine to the stream.
+type asyncLexer struct {
+	batches chan tokenBatch
+	done    chan struct{}
+	stop    sync.Once
+	// the last token of the stream
+	tail *Token
+	// replaced or removed open brackets which wait for close tokens, see Stream.forward
+	forwards map[*Token]*Token
+}
+
+// Async moves lexing of the infinite stream into a background goroutine.
+// The goroutine reads and lexes up to `ahead` chunks of data in advance and waits while the stream consumes them,
+// so I/O and lexing overlap with parsing. Reader errors and diagnostics are delivered through the stream, see Err and Diagnostics.
+// Close stops the goroutine (a pending Read of the reader is not interrupted), so Close must be called.
+// Async has no effect on the stream of bytes or string.
+//
+//	stream := parser.ParseStream(fp, 4096).Async(8)
+//	defer stream.Close()
+func (s *Stream) Async(ahead int) *Stream {
+	if s.p == nil {
+		return s
+	}
+	if ahead < 1 {
+		ahead = 1
+	}
+	p := s.p
+	s.p = nil
+	s.parsed = p.parsed + p.pos
+	s.diagnostics = append([]Diagnostic(nil), p.diagnostics...)
+	s.err = p.err
+	s.async = &asyncLexer{
+		batches: make(chan tokenBatch, ahead),
+		done:    make(chan struct{}),
+		tail:    p.ptr,
+	}
+	// detach tokens from the parser, the stream owns them
+	p.head, p.ptr = nil, nil
+	p.detached = true
+	go s.async.produce(p)
+	return s
+}
+
+// produce lexes data chunk by chunk and sends tokens to the stream until the data ends or the stream is closed.
+func (a *asyncLexer) produce(p *parsing) {
+	defer close(a.batches)
+	sent := len(p.diagnostics)
+	for {
+		n := p.parseNext()
+		batch := tokenBatch{
+			head:   p.head,
+			tail:   p.ptr,
+			n:      n,
+			parsed: p.parsed + p.pos,
+		}
+		if len(p.diagnostics) > sent {
+			batch.diagnostics = append([]Diagnostic(nil), p.diagnostics[sent:]...)
+			sent = len(p.diagnostics)
+		}
+		p.head, p.ptr = nil, nil
+		if n == 0 {
+			batch.err = p.err
+		}
+		select {
+		case a.batches <- batch:
+		case <-a.done:
+			return
+		}
+		if n == 0 {
+			return
+		}
+	}
+}
+
+// cancel stops the producer goroutine.
+func (a *asyncLexer) cancel() {
+	a.stop.Do(func() {
+		close(a.done)
+	})
+}
+
+// receive links the next batch of tokens to the stream.
+// Method waits for the producer and returns count of new tokens, 0 means the end of the data.
+func (s *Stream) receive() int {
+	for batch := range s.async.batches {
+		s.parsed = batch.parsed
+		s.diagnostics = append(s.diagnostics, batch.diagnostics...)
+		if batch.err != nil {
+			s.err = batch.err
+		}
+		if batch.n == 0 {
+			continue
+		}
+		if s.t.brackets != nil {
+			// the producer links close brackets only, open brackets are owned by the stream
+			for token := batch.head; token != nil; token = token.next {
+				for substitute, ok := s.async.forwards[token.pair]; ok; substitute, ok = s.async.forwards[token.pair] {
+					delete(s.async.forwards, token.pair)
+					token.pair = substitute
+				}
+				if token.pair != nil {
+					token.pair.pair = token
+				}
+			}
+		}
+		if s.async.tail != nil {
+			s.async.tail.addNext(batch.head)
+		} else {
+			s.head = batch.head
+			s.current = batch.head
+		}
+		s.async.tail = batch.tail
+		return batch.n
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package tokenizer
+
+import "iter"
+
+// All returns an iterator over tokens from the current token to the end of the stream.
+// The iterator yields index of the token in the iteration (from 0) and the token.
+// The stream pointer follows the iteration: if the loop breaks, the current token is the last yielded one.
+// Iteration stops when data ends or the reader fails, see Err.
+//
+//	for i, token := range stream.All() {
+//		// ...
+//	}
+//	if err := stream.Err(); err != nil {
+//		// ...
+//	}
+func (s *Stream) All() iter.Seq2[int, *Token] {
+	return func(yield func(int, *Token) bool) {
+		for i := 0; s.IsValid(); i++ {
+			if !yield(i, s.current) {
+				return
+			}
+			s.GoNext()
+		}
+	}
+}
+
+// Tokens returns an iterator over tokens from the current token to the end of the stream, see All.
+func (s *Stream) Tokens() iter.Seq[*Token] {
+	return func(yield func(*Token) bool) {
+		for _, token := range s.All() {
+			if !yield(token) {
+				return
+			}
+		}
+	}
+}
+
+// Filter returns an iterator over tokens with specific keys from the current token to the end of the stream, see All.
+// The index is the index of the token in the iteration including skipped tokens.
+//
+//	for _, token := range stream.Filter(tokenizer.TokenKeyword) {
+//		// ...
+//	}
+func (s *Stream) Filter(key TokenKey, otherKeys ...TokenKey) iter.Seq2[int, *Token] {
+	return func(yield func(int, *Token) bool) {
+		for i, token := range s.All() {
+			if token.Is(key, otherKeys...) && !yield(i, token) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+//go:build go1.23
+
+package tokenizer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamIterators(t *testing.T) {
+	const commaKey = TokenKey(10)
+	tokenizer := New().DefineTokens(commaKey, []string{","})
+
+	t.Run("all", func(t *testing.T) {
+		var (
+			indexes []int
+			values  []string
+		)
+		for i, token := range tokenizer.ParseString("a, b, 1").All() {
+			indexes = append(indexes, i)
+			values = append(values, token.ValueString())
+		}
+		require.Equal(t, []int{0, 1, 2, 3, 4}, indexes)
+		require.Equal(t, []string{"a", ",", "b", ",", "1"}, values)
+	})
+
+	t.Run("break", func(t *testing.T) {
+		stream := tokenizer.ParseString("a, b, 1")
+		for token := range stream.Tokens() {
+			if token.Is(commaKey) {
+				break
+			}
+		}
+		require.Equal(t, ",", stream.CurrentToken().ValueString())
+		require.Equal(t, 1, stream.CurrentToken().ID())
+
+		var values []string
+		for token := range stream.GoNext().Tokens() {
+			values = append(values, token.ValueString())
+		}
+		require.Equal(t, []string{"b", ",", "1"}, values)
+		require.False(t, stream.IsValid())
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		var (
+			indexes []int
+			values  []string
+		)
+		for i, token := range tokenizer.ParseString("a, b, 1").Filter(TokenKeyword, TokenInteger) {
+			indexes = append(indexes, i)
+			values = append(values, token.ValueString())
+		}
+		require.Equal(t, []int{0, 2, 4}, indexes)
+		require.Equal(t, []string{"a", "b", "1"}, values)
+	})
+
+	t.Run("reader error", func(t *testing.T) {
+		failure := errors.New("read failure")
+		reader := io.MultiReader(bytes.NewBufferString("a, b"), &failedReader{err: failure})
+		stream := tokenizer.ParseStream(reader, 4)
+		var values []string
+		for token := range stream.Tokens() {
+			values = append(values, token.ValueString())
+		}
+		require.Equal(t, []string{"a", ",", "b"}, values)
+		require.Equal(t, failure, stream.Err())
+		require.NoError(t, tokenizer.ParseStream(bytes.NewBufferString("a"), 4).Err())
+	})
+}
+
+type failedReader struct {
+	err error
+}
+
+func (r *failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
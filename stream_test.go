@@ -2,8 +2,12 @@ package tokenizer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/stretchr/testify/require"
@@ -390,6 +394,25 @@ func BenchmarkParseInfStream(b *testing.B) {
 	b.Logf("Speed: %d bytes at %s: %d byte/sec", len(reader.data), dif, int(float64(len(reader.data))/dif.Seconds()))
 }
 
+func BenchmarkParseInfStreamAsync(b *testing.B) {
+	reader := newDataGenerator(b.N)
+	tokenizer := New()
+	tokenizer.DefineTokens(1, []string{"<"})
+	tokenizer.DefineTokens(2, []string{">"})
+	tokenizer.DefineTokens(3, []string{"="})
+	tokenizer.DefineTokens(4, []string{"/"})
+	tokenizer.DefineStringToken(5, `"`, `"`).SetEscapeSymbol('\\')
+	tokenizer.DefineStringToken(6, `<![CDATA[`, `]]>`)
+
+	b.ResetTimer()
+	stream := tokenizer.ParseStream(reader, 4096).SetHistorySize(10).Async(8)
+	defer stream.Close()
+
+	for stream.IsValid() {
+		stream.GoNext()
+	}
+}
+
 func BenchmarkParseBytes(b *testing.B) {
 	reader := newDataGenerator(b.N)
 	tokenizer := New()
@@ -417,6 +440,27 @@ func BenchmarkParseBytes(b *testing.B) {
 	b.Logf("Speed: %d bytes string with %s: %d byte/sec", size, dif, int(float64(size)/dif.Seconds()))
 }
 
+func BenchmarkParseBytesParallel(b *testing.B) {
+	reader := newDataGenerator(b.N)
+	tokenizer := New()
+	tokenizer.DefineTokens(1, []string{"<"})
+	tokenizer.DefineTokens(2, []string{">"})
+	tokenizer.DefineTokens(3, []string{"="})
+	tokenizer.DefineTokens(4, []string{"/"})
+	tokenizer.DefineStringToken(5, `"`, `"`).SetEscapeSymbol('\\')
+	tokenizer.DefineStringToken(6, `<![CDATA[`, `]]>`)
+
+	b.ResetTimer()
+
+	t := time.Now()
+	stream := tokenizer.ParseBytesParallel(reader.data, 0)
+	stream.IsValid()
+
+	dif := time.Since(t)
+	size := len(reader.data)
+	b.Logf("Speed: %d bytes string with %s: %d byte/sec", size, dif, int(float64(size)/dif.Seconds()))
+}
+
 func BenchmarkMap(b *testing.B) {
 	mp := map[byte]bool{
 		'0': true,
@@ -469,3 +513,438 @@ func BenchmarkSlice(b *testing.B) {
 	}
 
 }
+
+// manyTokensGrammar defines hundreds of operators and keywords that share prefixes.
+func manyTokensGrammar() (*Tokenizer, []byte) {
+	tokenizer := New()
+	symbols := []byte("<>=!&|+-*/%^~:")
+	var operators []string
+	for _, a := range symbols {
+		operators = append(operators, string(a))
+		for _, b := range symbols {
+			operators = append(operators, string([]byte{a, b}))
+			operators = append(operators, string([]byte{a, b, a}))
+		}
+	}
+	var keywords []string
+	for _, root := range []string{"select", "insert", "update", "delete", "create", "alter", "drop", "grant"} {
+		for i := 1; i <= len(root); i++ {
+			keywords = append(keywords, root[:i], root[:i]+"_all", root[:i]+"_any")
+		}
+	}
+	for i, op := range operators {
+		tokenizer.DefineTokens(TokenKey(i+1), []string{op})
+	}
+	tokenizer.DefineTokens(TokenKey(len(operators)+1), keywords)
+
+	var data []byte
+	for i := 0; len(data) < 1<<20; i++ {
+		data = append(data, operators[(i*7)%len(operators)]...)
+		data = append(data, ' ')
+		data = append(data, keywords[(i*13)%len(keywords)]...)
+		data = append(data, " 12 "...)
+	}
+	return tokenizer, data
+}
+
+func BenchmarkParseBytesManyTokens(b *testing.B) {
+	tokenizer, data := manyTokensGrammar()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokenizer.ParseBytes(data).Close()
+	}
+}
+
+func BenchmarkParseLongStrings(b *testing.B) {
+	tokenizer := New()
+	tokenizer.DefineTokens(1, []string{"=", ";"})
+	tokenizer.DefineStringToken(2, `"`, `"`).SetEscapeSymbol('\\')
+	tokenizer.DefineStringToken(3, "/*", "*/")
+	blob := bytes.Repeat([]byte("QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo="), 2000)
+	var data []byte
+	for len(data) < 1<<20 {
+		data = append(data, "blob = \""...)
+		data = append(data, blob...)
+		data = append(data, "\"; /* "...)
+		data = append(data, blob...)
+		data = append(data, "\n */\n"...)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokenizer.ParseBytes(data).Close()
+	}
+}
+
+func TestAsyncStream(t *testing.T) {
+	tokenizer := New()
+	tokenizer.DefineTokens(1, []string{"<"})
+	tokenizer.DefineTokens(2, []string{">"})
+	tokenizer.DefineTokens(3, []string{"="})
+	tokenizer.DefineTokens(4, []string{"/"})
+	tokenizer.DefineStringToken(5, `"`, `"`).SetEscapeSymbol('\\')
+	tokenizer.DefineStringToken(6, `<![CDATA[`, `]]>`)
+
+	collect := func(stream *Stream) []string {
+		var tokens []string
+		for stream.IsValid() {
+			token := stream.CurrentToken()
+			tokens = append(tokens, fmt.Sprintf("%d:%d:%d:%s", token.ID(), token.Line(), token.Offset(), token.Value()))
+			stream.GoNext()
+		}
+		return tokens
+	}
+
+	t.Run("same tokens", func(t *testing.T) {
+		expected := collect(tokenizer.ParseStream(newDataGenerator(200), 64).SetHistorySize(10))
+		stream := tokenizer.ParseStream(newDataGenerator(200), 64).SetHistorySize(10).Async(2)
+		defer stream.Close()
+		require.Equal(t, expected, collect(stream))
+		require.Equal(t, len(pattern)*200, stream.GetParsedLength())
+		require.NoError(t, stream.Err())
+	})
+
+	t.Run("signed numbers and diagnostics", func(t *testing.T) {
+		parser := New().AllowSignedNumbers().RejectUnknownNumberSuffixes()
+		source := strings.Repeat("a -1 [-2] 3px ", 50)
+		expected := parser.ParseStream(iotest.OneByteReader(strings.NewReader(source)), 8)
+		stream := parser.ParseStream(iotest.OneByteReader(strings.NewReader(source)), 8).Async(1)
+		defer stream.Close()
+		require.Equal(t, collect(expected), collect(stream))
+		require.Len(t, stream.Diagnostics(), 50)
+		require.Equal(t, expected.Diagnostics(), stream.Diagnostics())
+	})
+
+	t.Run("reader error", func(t *testing.T) {
+		failure := errors.New("read failure")
+		reader := io.MultiReader(strings.NewReader("a = b"), iotest.ErrReader(failure))
+		stream := tokenizer.ParseStream(reader, 2).Async(4)
+		defer stream.Close()
+		require.Equal(t, []string{"0:1:0:a", "1:1:2:=", "2:1:4:b"}, collect(stream))
+		require.Equal(t, failure, stream.Err())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		stream := tokenizer.ParseStream(newDataGenerator(1000), 64).Async(1)
+		async := stream.async
+		stream.GoNext().GoNext()
+		stream.Close()
+		require.False(t, stream.IsValid())
+		// the producer stops and closes the channel
+		for range async.batches {
+		}
+	})
+}
+
+func TestStreamShortReads(t *testing.T) {
+	tokenizer := New()
+	tokenizer.DefineTokens(1, []string{"<"})
+	tokenizer.DefineTokens(2, []string{"/>", ">"})
+	tokenizer.DefineStringToken(3, `<![CDATA[`, `]]>`)
+	source := strings.Repeat(`<a><![CDATA[one two]]> 12.5e3 </> `, 20)
+
+	var expected, actual []string
+	for stream := tokenizer.ParseString(source); stream.IsValid(); stream.GoNext() {
+		expected = append(expected, stream.CurrentToken().ValueString())
+	}
+	stream := tokenizer.ParseStream(iotest.OneByteReader(strings.NewReader(source)), 16)
+	for ; stream.IsValid(); stream.GoNext() {
+		actual = append(actual, stream.CurrentToken().ValueString())
+	}
+	require.Equal(t, expected, actual)
+	require.Equal(t, len(source), stream.GetParsedLength())
+}
+
+func TestParseBytesParallel(t *testing.T) {
+	layout := parallelLayout{minSegment: 64, syncWindow: 256}
+	openKey := TokenKey(1)
+	closeKey := TokenKey(2)
+	minusKey := TokenKey(3)
+	commaKey := TokenKey(4)
+	quoteKey := TokenKey(5)
+	commentKey := TokenKey(6)
+	tokenizer := New()
+	tokenizer.AllowSignedNumbers(closeKey).AllowNumberSuffixes([]string{"ms"}).RejectUnknownNumberSuffixes()
+	tokenizer.DefineTokens(openKey, []string{"{", "("})
+	tokenizer.DefineTokens(closeKey, []string{"}", ")"})
+	tokenizer.DefineTokens(minusKey, []string{"-"})
+	tokenizer.DefineTokens(commaKey, []string{","})
+	tokenizer.DefineStringToken(quoteKey, `"`, `"`).SetEscapeSymbol(BackSlash).AddInjection(openKey, closeKey)
+	tokenizer.DefineStringToken(commentKey, "//", "\n")
+
+	var source strings.Builder
+	for i := 0; i < 300; i++ {
+		switch i % 6 {
+		case 0:
+			fmt.Fprintf(&source, "key%d = -%d, (x) -1 10ms 5px\n", i, i)
+		case 1:
+			fmt.Fprintf(&source, "\"multi\nline\n{ name%d }\nstring\" // comment %d\n", i, i)
+		case 2:
+			fmt.Fprintf(&source, "\t\tключ %d.%d, \"\\\"escaped\n\"\n", i, i)
+		case 3:
+			fmt.Fprintf(&source, "\"{ \"nested\n%d\" }\"\n\n", i)
+		case 4:
+			source.WriteString("-\n1\n")
+		default:
+			fmt.Fprintf(&source, "// only comment %d\n", i)
+		}
+	}
+	source.WriteString("  \n ")
+
+	data := []byte(source.String())
+	expected := tokenizer.ParseBytes(data)
+	require.NotEmpty(t, expected.Diagnostics())
+	for _, workers := range []int{1, 2, 3, 8, 64} {
+		stream := tokenizer.parseParallel(data, workers, layout)
+		require.Equal(t, streamTokens(expected), streamTokens(stream), "workers %d", workers)
+		require.Equal(t, expected.len, stream.len, "workers %d", workers)
+		require.Equal(t, expected.Diagnostics(), stream.Diagnostics(), "workers %d", workers)
+		require.Equal(t, expected.GetParsedLength(), stream.GetParsedLength(), "workers %d", workers)
+		require.Equal(t, expected.wsTail, stream.wsTail, "workers %d", workers)
+	}
+
+	t.Run("stop on unknown", func(t *testing.T) {
+		parser := New().StopOnUndefinedToken()
+		data := []byte(strings.Repeat("one two\n", 100) + "? " + strings.Repeat("three\n", 100))
+		expected := parser.ParseBytes(data)
+		stream := parser.parseParallel(data, 8, layout)
+		require.Equal(t, streamTokens(expected), streamTokens(stream))
+		require.Equal(t, expected.GetParsedLength(), stream.GetParsedLength())
+	})
+
+	t.Run("no newlines", func(t *testing.T) {
+		data := []byte(strings.Repeat(`a = "b c" -1, `, 200))
+		require.Equal(t, streamTokens(tokenizer.ParseBytes(data)), streamTokens(tokenizer.parseParallel(data, 8, layout)))
+		require.Greater(t, len(tokenizer.splitSegments(data, 8, layout)), 1)
+
+		// whitespaces are looked for only within the sync window after the planned boundary
+		data = []byte(strings.Repeat("x", 1000) + " " + strings.Repeat("y", 100))
+		require.Equal(t, []int{0, 1001}, tokenizer.splitSegments(data, 8, layout))
+		require.Equal(t, streamTokens(tokenizer.ParseBytes(data)), streamTokens(tokenizer.parseParallel(data, 8, layout)))
+	})
+
+	t.Run("string over segments", func(t *testing.T) {
+		// the string spans several segments, the first token after it keeps its indent
+		data := []byte("a \"" + strings.Repeat(strings.Repeat("s", 99)+"\n", 20) + "\"\n  b\n" + strings.Repeat("c d\n", 50))
+		require.Greater(t, len(tokenizer.splitSegments(data, 8, layout)), 4)
+		expected := streamTokens(tokenizer.ParseBytes(data))
+		require.Equal(t, "\n  ", expected[2].indent)
+		for _, workers := range []int{2, 4, 8} {
+			require.Equal(t, expected, streamTokens(tokenizer.parseParallel(data, workers, layout)), "workers %d", workers)
+		}
+	})
+
+	t.Run("small data", func(t *testing.T) {
+		require.Equal(t, streamTokens(tokenizer.ParseString("a, b")), streamTokens(tokenizer.ParseBytesParallel([]byte("a, b"), 4)))
+	})
+}
+
+func TestStreamMarks(t *testing.T) {
+	tokenizer := New()
+
+	t.Run("rewind", func(t *testing.T) {
+		stream := tokenizer.ParseString("0 1 2 3 4 5 6 7 8 9")
+		stream.GoNext()
+		mark := stream.Mark()
+		stream.GoNext().GoNext().GoNext()
+		require.Equal(t, int64(4), stream.CurrentToken().ValueInt64())
+		stream.Rewind(mark)
+		require.Equal(t, int64(1), stream.CurrentToken().ValueInt64())
+		stream.GoTo(9).GoNext()
+		require.False(t, stream.IsValid())
+		stream.Rewind(mark)
+		require.Equal(t, int64(1), stream.CurrentToken().ValueInt64())
+		stream.Release(mark)
+		stream.Release(mark)
+		require.PanicsWithValue(t, errReleasedMark, func() {
+			stream.Rewind(mark)
+		})
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		stream := tokenizer.ParseString("0 1 2")
+		stream.GoTo(2).GoNext()
+		require.False(t, stream.IsValid())
+		end := stream.Mark()
+		stream.GoNext()
+		require.False(t, stream.IsValid())
+		stream.GoPrev()
+		require.Equal(t, 2, stream.CurrentToken().ID())
+		stream.Rewind(end).GoPrev()
+		require.Equal(t, 2, stream.CurrentToken().ID())
+		stream.GoTo(0).GoPrev()
+		require.False(t, stream.IsValid())
+		stream.GoPrev().GoNext()
+		require.Equal(t, 0, stream.CurrentToken().ID())
+		stream.GoPrev().GoTo(1)
+		require.Equal(t, 1, stream.CurrentToken().ID())
+	})
+
+	t.Run("pinned history", func(t *testing.T) {
+		var source strings.Builder
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&source, "%d ", i)
+		}
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 16).SetHistorySize(2)
+		stream.GoTo(10)
+		outer := stream.Mark()
+		stream.GoTo(20)
+		inner := stream.Mark()
+		stream.GoTo(50)
+		require.Equal(t, 10, stream.HeadToken().ID())
+		stream.Release(outer)
+		stream.GoNext()
+		require.Equal(t, 20, stream.HeadToken().ID())
+		stream.Rewind(inner)
+		require.Equal(t, int64(20), stream.CurrentToken().ValueInt64())
+		stream.Release(inner)
+		stream.GoTo(60)
+		require.Equal(t, 58, stream.HeadToken().ID())
+
+		// the later mark pins older tokens
+		late := stream.GoTo(70).Mark()
+		early := stream.GoPrev().Mark()
+		stream.GoTo(90)
+		require.Equal(t, 69, stream.HeadToken().ID())
+		stream.Release(early)
+		stream.GoNext()
+		require.Equal(t, 70, stream.HeadToken().ID())
+		stream.Release(late)
+		stream.GoNext()
+		require.Equal(t, 90, stream.HeadToken().ID())
+	})
+}
+
+func TestStreamPeek(t *testing.T) {
+	tokenizer := New()
+
+	t.Run("bytes", func(t *testing.T) {
+		stream := tokenizer.ParseString("0 1 2 3")
+		require.Equal(t, 0, stream.Peek(0).ID())
+		require.Equal(t, 2, stream.Peek(2).ID())
+		require.Equal(t, TokenUndef, stream.PeekKey(4))
+		require.Equal(t, TokenUndef, stream.PeekKey(-1))
+		stream.GoTo(2)
+		require.Equal(t, int64(1), stream.Peek(-1).ValueInt64())
+		require.Equal(t, int64(3), stream.Peek(1).ValueInt64())
+		require.Equal(t, 2, stream.CurrentToken().ID())
+
+		stream.GoTo(3).GoNext()
+		require.False(t, stream.IsValid())
+		require.Equal(t, 3, stream.Peek(-1).ID())
+		require.Equal(t, 0, stream.Peek(-4).ID())
+		require.Equal(t, TokenUndef, stream.PeekKey(1))
+
+		stream.GoTo(0).GoPrev()
+		require.Equal(t, 0, stream.Peek(1).ID())
+		require.Equal(t, TokenUndef, stream.PeekKey(-1))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var source strings.Builder
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&source, "%d ", i)
+		}
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 16).SetHistorySize(2)
+		require.Equal(t, int64(50), stream.Peek(50).ValueInt64())
+		require.Equal(t, TokenUndef, stream.PeekKey(100))
+		require.Equal(t, 0, stream.CurrentToken().ID())
+		require.Equal(t, 0, stream.HeadToken().ID())
+
+		stream.GoTo(10)
+		require.Equal(t, 8, stream.HeadToken().ID())
+		require.Equal(t, int64(8), stream.Peek(-2).ValueInt64())
+		require.Equal(t, TokenUndef, stream.PeekKey(-3))
+	})
+
+	t.Run("async", func(t *testing.T) {
+		var source strings.Builder
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&source, "%d ", i)
+		}
+		stream := tokenizer.ParseStream(strings.NewReader(source.String()), 16).Async(2)
+		defer stream.Close()
+		require.Equal(t, int64(99), stream.Peek(99).ValueInt64())
+		require.True(t, stream.IsNextSequence(TokenInteger, TokenInteger))
+		require.Equal(t, 0, stream.CurrentToken().ID())
+	})
+}
+
+func TestStreamExpect(t *testing.T) {
+	equalityKey := TokenKey(10)
+	semicolonKey := TokenKey(11)
+	quoteKey := TokenKey(12)
+	tokenizer := New()
+	tokenizer.DefineTokens(equalityKey, []string{"=", "=="}).NameKey(equalityKey, "TEquality")
+	tokenizer.DefineTokens(semicolonKey, []string{";"})
+	tokenizer.DefineStringToken(quoteKey, `"`, `"`)
+	source := "a = 1;\n\tb == \"x\ny\" c;\n\tё = 2"
+
+	check := func(t *testing.T, stream *Stream) {
+		token, err := stream.Expect(TokenKeyword)
+		require.NoError(t, err)
+		require.Equal(t, "a", token.ValueString())
+		token, err = stream.ExpectValue(equalityKey, "=")
+		require.NoError(t, err)
+		require.Equal(t, 1, token.ID())
+		require.Equal(t, 2, stream.CurrentToken().ID())
+
+		_, err = stream.GoTo(5).ExpectValue(equalityKey, "=")
+		var syntaxErr *SyntaxError
+		require.True(t, errors.As(err, &syntaxErr))
+		require.EqualError(t, err, `2:4: syntax error: unexpected TEquality "==", expected TEquality "="`)
+		require.Equal(t, 5, stream.CurrentToken().ID())
+		require.Equal(t, 5, syntaxErr.Token.ID())
+		require.Equal(t, 2, syntaxErr.Line)
+		require.Equal(t, 10, syntaxErr.Offset)
+		require.Equal(t, 4, syntaxErr.Column)
+		require.Equal(t, []string{"TEquality"}, syntaxErr.Expected)
+		require.Equal(t, "2 |     b == \"x\n  |       ^~", syntaxErr.Snippet)
+
+		_, err = stream.GoTo(7).Expect(semicolonKey, equalityKey, TokenString)
+		require.EqualError(t, err, `3:4: syntax error: unexpected TokenKeyword "c", expected TokenKey(11), TEquality or TokenString`)
+		require.Equal(t, "3 | y\" c;\n  |    ^", err.(*SyntaxError).Snippet)
+
+		_, err = stream.GoTo(10).Expect(semicolonKey)
+		require.EqualError(t, err, `4:5: syntax error: unexpected TEquality "=", expected TokenKey(11)`)
+		require.Equal(t, "4 |     ё = 2\n  |       ^", err.(*SyntaxError).Snippet)
+
+		stream.GoNext().GoNext()
+		require.False(t, stream.IsValid())
+		_, err = stream.Expect(semicolonKey)
+		require.EqualError(t, err, `4:8: syntax error: unexpected end of stream, expected TokenKey(11)`)
+		require.Equal(t, "4 |     ё = 2\n  |          ^", err.(*SyntaxError).Snippet)
+		require.Equal(t, TokenUndef, err.(*SyntaxError).Token.Key())
+	}
+
+	t.Run("bytes", func(t *testing.T) {
+		check(t, tokenizer.ParseString(source))
+	})
+	t.Run("stream", func(t *testing.T) {
+		check(t, tokenizer.ParseStream(strings.NewReader(source), 4))
+	})
+	t.Run("empty", func(t *testing.T) {
+		_, err := tokenizer.ParseString("  ").Expect(TokenKeyword)
+		require.EqualError(t, err, `1:1: syntax error: unexpected end of stream, expected TokenKeyword`)
+	})
+}
+
+func TestStreamGoTo(t *testing.T) {
+	tokenizer := New()
+	stream := tokenizer.ParseString("a b c")
+	require.Equal(t, "c", stream.GoTo(99).CurrentToken().ValueString())
+	require.Equal(t, "a", stream.GoTo(-1).CurrentToken().ValueString())
+	stream.GoTo(2).GoNext()
+	require.False(t, stream.IsValid())
+	require.Equal(t, "c", stream.GoTo(99).CurrentToken().ValueString())
+	stream.GoTo(0).GoPrev()
+	require.False(t, stream.IsValid())
+	require.Equal(t, "a", stream.GoTo(-1).CurrentToken().ValueString())
+
+	// the oldest token of the history
+	stream = tokenizer.ParseStream(strings.NewReader("0 1 2 3 4 5 6 7 8 9"), 4).SetHistorySize(2)
+	stream.GoTo(8)
+	require.Equal(t, 6, stream.HeadToken().ID())
+	require.Equal(t, 6, stream.GoTo(0).CurrentToken().ID())
+}
@@ -0,0 +1,139 @@
+package tokenizer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError describes an unexpected token, see Stream.Expect and Stream.ExpectValue.
+type SyntaxError struct {
+	// Token is a copy of the unexpected token. Token has TokenUndef key at the end of the stream.
+	Token Token
+	// Line number of the token. Line numbers starts from 1.
+	Line int
+	// Offset is the byte position of the token in input string (from start).
+	Offset int
+	// Column is the byte position of the token in the line. Columns starts from 1.
+	Column int
+	// Expected contains names of expected keys, see Tokenizer.NameKey.
+	Expected []string
+	// Value is the expected value of the token, if any.
+	Value string
+	// Snippet is the line of the source with the underlined token, see Stream.Excerpt:
+	//
+	//	1 | user_id = = 119
+	//	  |           ^
+	Snippet string
+}
+
+// Error formats the error like the Go compiler: `line:column: syntax error: unexpected ..., expected ...`.
+func (e *SyntaxError) Error() string {
+	var got string
+	if e.Token.key == TokenUndef {
+		got = "end of stream"
+	} else {
+		got = e.Token.KeyName() + " " + strconv.Quote(string(e.Token.value))
+	}
+	msg := fmt.Sprintf("%d:%d: syntax error: unexpected %s", e.Line, e.Column, got)
+	if len(e.Expected) == 0 {
+		return msg
+	}
+	expected := e.Expected[len(e.Expected)-1]
+	if len(e.Expected) > 1 {
+		expected = strings.Join(e.Expected[:len(e.Expected)-1], ", ") + " or " + expected
+	}
+	if e.Value != "" {
+		expected += " " + strconv.Quote(e.Value)
+	}
+	return msg + ", expected " + expected
+}
+
+// Expect checks that the current token has one of the keys, returns it and moves the pointer to the next token.
+// Otherwise, returns *SyntaxError and the pointer is not moved.
+//
+//	if _, err := stream.Expect(TEquality); err != nil {
+//		return err // 1:9: syntax error: unexpected TokenInteger "119", expected TEquality
+//	}
+func (s *Stream) Expect(keys ...TokenKey) (*Token, error) {
+	token := s.current
+	for _, key := range keys {
+		if token.key == key && token != undefToken {
+			s.GoNext()
+			return token, nil
+		}
+	}
+	return nil, s.syntaxError(keys, "")
+}
+
+// ExpectValue checks that the current token has the key and the value, returns it and moves the pointer to the next token.
+// Otherwise, returns *SyntaxError and the pointer is not moved.
+func (s *Stream) ExpectValue(key TokenKey, value string) (*Token, error) {
+	token := s.current
+	if token.key == key && token != undefToken && string(token.value) == value {
+		s.GoNext()
+		return token, nil
+	}
+	return nil, s.syntaxError([]TokenKey{key}, value)
+}
+
+// syntaxError creates the error for the current token.
+func (s *Stream) syntaxError(keys []TokenKey, value string) *SyntaxError {
+	err := &SyntaxError{
+		Line:     1,
+		Expected: make([]string, len(keys)),
+		Value:    value,
+	}
+	for i, key := range keys {
+		err.Expected[i] = s.t.KeyName(key)
+	}
+	var prefix []byte
+	if token := s.current; token != undefToken {
+		err.Token = Token{
+			id:        token.id,
+			key:       token.key,
+			value:     append([]byte(nil), token.value...),
+			line:      token.line,
+			offset:    token.offset,
+			indent:    append([]byte(nil), token.indent...),
+			string:    token.string,
+			suffix:    token.suffix,
+			format:    token.format,
+			tokenizer: s.t,
+		}
+		err.Line, err.Offset = token.line, token.offset
+		prefix = s.linePrefix(token, token.offset)
+	} else {
+		err.Token = Token{id: -1, key: TokenUndef, tokenizer: s.t}
+		if last := s.prev; last != nil { // the position right after the last token
+			err.Line = last.line + bytes.Count(last.value, []byte{newLine})
+			err.Offset = last.offset + len(last.value)
+			prefix = s.linePrefix(last, err.Offset)
+		} else if first := s.next; first != nil { // the position of the first token
+			err.Line, err.Offset = first.line, first.offset
+			prefix = s.linePrefix(first, first.offset)
+		}
+	}
+	err.Column = len(prefix) + 1
+	err.Snippet = s.ExcerptRange(err.Offset, err.Offset+len(err.Token.value), 0)
+	return err
+}
+
+// linePrefix reconstructs the part of the source line before the offset in the token from values and indents
+// of previous tokens, see sourceOf.
+// If the beginning of the line is evicted from the history (see SetHistorySize) the prefix starts from the oldest token.
+func (s *Stream) linePrefix(token *Token, offset int) []byte {
+	first := token
+	for first.prev != nil && !bytes.ContainsRune(first.indent, newLine) {
+		if first = first.prev; !first.IsSynthetic() && bytes.ContainsRune(first.value, newLine) {
+			break
+		}
+	}
+	source, base := sourceOf(first, token)
+	prefix := source[:clamp(offset-base, 0, len(source))]
+	if i := bytes.LastIndexByte(prefix, newLine); i != -1 {
+		prefix = prefix[i+1:]
+	}
+	return prefix
+}
@@ -3,6 +3,7 @@ package tokenizer
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
@@ -10,6 +11,18 @@ var undefToken = &Token{
 	id: -1,
 }
 
+// tokenFlag is a set of token properties.
+type tokenFlag uint8
+
+const (
+	// flagInjectionStart marks the start token of the injection into a framed string.
+	flagInjectionStart tokenFlag = 1 << iota
+	// flagInjectionEnd marks the end token of the injection into a framed string.
+	flagInjectionEnd
+	// flagSynthetic marks the token which is not a part of the source, see Stream.InsertBefore.
+	flagSynthetic
+)
+
 // Token struct describe one token.
 type Token struct {
 	id     int
@@ -19,6 +32,19 @@ type Token struct {
 	offset int
 	indent []byte
 	string *StringSettings
+	// length of the number suffix at the end of the value
+	suffix int
+	// format of the number, nil means default format
+	format *NumberFormat
+	// tokenizer resolves names of keys, nil for detached tokens
+	tokenizer *Tokenizer
+	flags     tokenFlag
+	// the paired bracket, see Tokenizer.DefineBrackets
+	pair *Token
+	// count of open brackets around the token
+	depth int
+	// see Tokenizer.SetChannel
+	channel Channel
 
 	prev *Token
 	next *Token
@@ -48,8 +74,16 @@ func (t *Token) ID() int {
 
 // String returns a multiline string with the token's information.
 func (t *Token) String() string {
-	return fmt.Sprintf("{\n\tId: %d\n\tKey: %d\n\tValue: %s\n\tPosition: %d\n\tIndent: %d bytes\n\tLine: %d\n}",
-		t.id, t.key, t.value, t.offset, len(t.indent), t.line)
+	return fmt.Sprintf("{\n\tId: %d\n\tKey: %s\n\tValue: %s\n\tPosition: %d\n\tIndent: %d bytes\n\tLine: %d\n}",
+		t.id, t.KeyName(), t.value, t.offset, len(t.indent), t.line)
+}
+
+// KeyName returns the name of the token key, see Tokenizer.NameKey.
+func (t *Token) KeyName() string {
+	if t.tokenizer != nil {
+		return t.tokenizer.KeyName(t.key)
+	}
+	return t.key.String()
 }
 
 // IsValid checks if this token is valid — the key is not TokenUndef.
@@ -83,10 +117,10 @@ func (t *Token) IsInteger() bool {
 // Method doesn't use cache — each call starts a number parser.
 func (t *Token) ValueInt64() int64 {
 	if t.key == TokenInteger {
-		num, _ := strconv.ParseInt(b2s(t.value), 0, 64)
+		num, _ := strconv.ParseInt(b2s(t.number()), 0, 64)
 		return num
 	} else if t.key == TokenFloat {
-		num, _ := strconv.ParseFloat(b2s(t.value), 64)
+		num, _ := strconv.ParseFloat(b2s(t.number()), 64)
 		return int64(num)
 	}
 	return 0
@@ -102,10 +136,10 @@ func (t *Token) ValueInt() int64 {
 // Method doesn't use cache — each call starts a number parser.
 func (t *Token) ValueFloat64() float64 {
 	if t.key == TokenFloat {
-		num, _ := strconv.ParseFloat(b2s(t.value), 64)
+		num, _ := strconv.ParseFloat(b2s(t.number()), 64)
 		return num
 	} else if t.key == TokenInteger {
-		num, _ := strconv.ParseInt(b2s(t.value), 0, 64)
+		num, _ := strconv.ParseInt(b2s(t.number()), 0, 64)
 		return float64(num)
 	}
 	return 0.0
@@ -116,6 +150,68 @@ func (t *Token) ValueFloat() float64 {
 	return t.ValueFloat64()
 }
 
+// ValueDecimal returns exact decimal value of the number as a coefficient and an exponent:
+// value = coefficient * 10^exponent.
+// Digits are taken as is from the source, so there is no float64 rounding and the scale is kept.
+// For example, `1.25e-3` returns (125, -5) and `1_000.50` returns (100050, -2).
+// If the token is not TokenInteger or TokenFloat then method returns nil and zero.
+// Method doesn't use cache — each call starts a number parser.
+func (t *Token) ValueDecimal() (*big.Int, int) {
+	if t.key != TokenInteger && t.key != TokenFloat {
+		return nil, 0
+	}
+	digits, exp, ok := parseDecimal(t.number())
+	if !ok {
+		return nil, 0
+	}
+	coefficient, ok := new(big.Int).SetString(b2s(digits), 10)
+	if !ok {
+		return nil, 0
+	}
+	return coefficient, exp
+}
+
+// maxRatExponent limits the exponent of ValueRat, because 10^exponent is allocated as is.
+const maxRatExponent = 10000
+
+// ValueRat returns exact value of the number as big.Rat.
+// See ValueDecimal.
+// If the token is not TokenInteger or TokenFloat then method returns nil.
+// If the absolute value of the exponent is greater than 10000 (like `1e999999999`) then method returns nil too,
+// use ValueDecimal for such numbers.
+// Method doesn't use cache — each call starts a number parser.
+func (t *Token) ValueRat() *big.Rat {
+	coefficient, exp := t.ValueDecimal()
+	if coefficient == nil || exp > maxRatExponent || exp < -maxRatExponent {
+		return nil
+	}
+	r := new(big.Rat).SetInt(coefficient)
+	if exp > 0 {
+		r.Mul(r, new(big.Rat).SetInt(pow10(exp)))
+	} else if exp < 0 {
+		r.Quo(r, new(big.Rat).SetInt(pow10(-exp)))
+	}
+	return r
+}
+
+// NumberSuffix returns suffix (unit) of the number, like `ms` for `10ms`.
+// If the number has no suffix or the token is not a number, method returns nil.
+// See Tokenizer.AllowNumberSuffixes.
+func (t *Token) NumberSuffix() []byte {
+	if t.suffix == 0 {
+		return nil
+	}
+	return t.value[len(t.value)-t.suffix:]
+}
+
+// number returns value of the number token without suffix in default number format.
+func (t *Token) number() []byte {
+	if t.format != nil {
+		return t.format.normalize(t.value[:len(t.value)-t.suffix])
+	}
+	return t.value[:len(t.value)-t.suffix]
+}
+
 // Indent returns spaces before the token.
 func (t *Token) Indent() []byte {
 	return t.indent
@@ -155,6 +251,30 @@ func (t *Token) Offset() int {
 	return t.offset
 }
 
+// Pair returns the paired bracket of the open or close bracket, see Tokenizer.DefineBrackets.
+// If the bracket is not balanced or the token is not a bracket, the method returns TokenUndef token.
+// In the infinite stream the pair of the open bracket is known when the close bracket is parsed.
+func (t *Token) Pair() *Token {
+	return validateToken(t.pair)
+}
+
+// Depth returns count of open brackets around the token, see Tokenizer.DefineBrackets.
+// Brackets have the depth of tokens around them.
+func (t *Token) Depth() int {
+	return t.depth
+}
+
+// IsSynthetic checks if the token is not a part of the source: it is inserted into the stream or replaces a token,
+// see Stream.InsertBefore, Stream.InsertAfter and Stream.Replace.
+func (t *Token) IsSynthetic() bool {
+	return t.flags&flagSynthetic != 0
+}
+
+// Channel returns the channel of the token, see Tokenizer.SetChannel.
+func (t *Token) Channel() Channel {
+	return t.channel
+}
+
 // StringSettings returns StringSettings structure if token is framed string.
 func (t *Token) StringSettings() *StringSettings {
 	return t.string
@@ -257,6 +377,78 @@ func hasAnyPrefix(prefixes [][]byte, where []byte) []byte {
 	return nil
 }
 
+// parseDecimal splits lexed number to signed decimal digits and decimal exponent.
+// Underscores are skipped.
+func parseDecimal(value []byte) ([]byte, int, bool) {
+	var (
+		digits = make([]byte, 0, len(value))
+		exp    = 0
+		point  = false
+	)
+	if len(value) > 0 && (value[0] == '-' || value[0] == '+') {
+		if value[0] == '-' {
+			digits = append(digits, '-')
+		}
+		value = value[1:]
+	}
+	hasDigit := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case isNumberByte(c):
+			digits = append(digits, c)
+			hasDigit = true
+			if point {
+				exp--
+			}
+		case c == '_':
+		case c == '.':
+			point = true
+		case c == 'e' || c == 'E':
+			e, ok := parseExponent(value[i+1:])
+			if !ok {
+				return nil, 0, false
+			}
+			return digits, exp + e, hasDigit
+		default:
+			return nil, 0, false
+		}
+	}
+	return digits, exp, hasDigit
+}
+
+// parseExponent parses signed decimal exponent with optional underscores.
+func parseExponent(value []byte) (int, bool) {
+	var (
+		exp      = 0
+		negative = false
+		hasDigit = false
+	)
+	for i, c := range value {
+		switch {
+		case i == 0 && (c == '-' || c == '+'):
+			negative = c == '-'
+		case isNumberByte(c):
+			if exp > (1<<31)/10 {
+				return 0, false
+			}
+			exp = exp*10 + int(c-'0')
+			hasDigit = true
+		case c == '_':
+		default:
+			return 0, false
+		}
+	}
+	if negative {
+		exp = -exp
+	}
+	return exp, hasDigit
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
 func runeExists(s []rune, v rune) bool {
 	for _, val := range s {
 		if val == v {
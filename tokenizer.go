@@ -5,8 +5,12 @@
 package tokenizer
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"sync"
 )
 
@@ -38,6 +42,46 @@ const (
 	TokenUndef TokenKey = 0
 )
 
+var builtinKeyNames = map[TokenKey]string{
+	TokenUnknown:        "TokenUnknown",
+	TokenStringFragment: "TokenStringFragment",
+	TokenString:         "TokenString",
+	TokenFloat:          "TokenFloat",
+	TokenInteger:        "TokenInteger",
+	TokenKeyword:        "TokenKeyword",
+	TokenUndef:          "TokenUndef",
+}
+
+// keyNames are names of user keys set by Tokenizer.NameKey of all tokenizers, see TokenKey.String.
+var keyNames = struct {
+	sync.RWMutex
+	names map[TokenKey]string
+}{names: map[TokenKey]string{}}
+
+// String returns the name of the key: the name of the built-in key, like TokenKeyword, or the name of the user key
+// set by Tokenizer.NameKey. The key doesn't know its tokenizer, so if tokenizers name the key differently,
+// the last name wins; Tokenizer.KeyName and Token.KeyName resolve the name through the exact tokenizer.
+// Unnamed keys are formatted as TokenKey(N).
+func (k TokenKey) String() string {
+	if name, ok := builtinKeyNames[k]; ok {
+		return name
+	}
+	keyNames.RLock()
+	name, ok := keyNames.names[k]
+	keyNames.RUnlock()
+	if ok {
+		return name
+	}
+	return k.number()
+}
+
+// number formats the key as TokenKey(N).
+func (k TokenKey) number() string {
+	return "TokenKey(" + strconv.Itoa(int(k)) + ")"
+}
+
+var errCompiled = errors.New("tokenizer: compiled tokenizer can't be changed")
+
 // BackSlash just backslash byte
 const BackSlash = '\\'
 
@@ -88,13 +132,84 @@ type StringSettings struct {
 	EscapeSymbol byte
 	SpecSymbols  [][]byte
 	Injects      []QuoteInjectSettings
+
+	frozen bool
+	// tokenizer which the settings belongs to
+	tokenizer *Tokenizer
+	// start token which the byte classification table of the tokenizer was built from, see Tokenizer.reclassified
+	classified []byte
+	// bytes which stop fast scanning of the string: escape symbol, first bytes of end token and injections, new line
+	stops [256]bool
+	// count of new lines in the start and end tokens
+	startLines int
+	endLines   int
+	// values of exported fields which the tables were built from, see fresh
+	scanned struct {
+		start, end []byte
+		escape     byte
+		injects    []QuoteInjectSettings
+	}
+}
+
+// classify builds the table of bytes which interrupt fast scanning of the string.
+func (q *StringSettings) classify() {
+	var stops [256]bool
+	stops[newLine] = true
+	stops[q.EscapeSymbol] = true
+	if len(q.EndToken) > 0 {
+		stops[q.EndToken[0]] = true
+	}
+	for _, inject := range q.Injects {
+		for _, token := range q.tokenizer.tokens[inject.StartKey] {
+			stops[token.Token[0]] = true
+		}
+	}
+	q.stops = stops
+	q.startLines = bytes.Count(q.StartToken, []byte{newLine})
+	q.endLines = bytes.Count(q.EndToken, []byte{newLine})
+	q.scanned.start = append(q.scanned.start[:0:0], q.StartToken...)
+	q.scanned.end = append(q.scanned.end[:0:0], q.EndToken...)
+	q.scanned.escape = q.EscapeSymbol
+	q.scanned.injects = append(q.scanned.injects[:0:0], q.Injects...)
+}
+
+// fresh checks if the tables of fast scanning were built from current values of exported fields.
+// The fields may be changed directly, then the parser scans the string byte by byte.
+func (q *StringSettings) fresh() bool {
+	if q.EscapeSymbol != q.scanned.escape || !bytes.Equal(q.StartToken, q.scanned.start) ||
+		!bytes.Equal(q.EndToken, q.scanned.end) || len(q.Injects) != len(q.scanned.injects) {
+		return false
+	}
+	for i, inject := range q.Injects {
+		if inject != q.scanned.injects[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot returns the frozen copy of the settings which doesn't share data with the settings.
+func (q *StringSettings) snapshot() *StringSettings {
+	c := q.clone(q.tokenizer)
+	c.frozen = true
+	c.classify()
+	return c
+}
+
+// mutable panics if the settings belongs to the compiled tokenizer.
+func (q *StringSettings) mutable() {
+	if q.frozen {
+		panic(errCompiled)
+	}
 }
 
 // AddInjection configure injection in to string.
 // Injection - parsable fragment of framed(quoted) string.
 // Often used for parsing of placeholders or template expressions in the framed string.
 func (q *StringSettings) AddInjection(startTokenKey, endTokenKey TokenKey) *StringSettings {
+	q.mutable()
 	q.Injects = append(q.Injects, QuoteInjectSettings{StartKey: startTokenKey, EndKey: endTokenKey})
+	q.classify()
 	return q
 }
 
@@ -102,7 +217,9 @@ func (q *StringSettings) AddInjection(startTokenKey, endTokenKey TokenKey) *Stri
 // Escape symbol allows ignoring close token of framed string.
 // Also, escape symbol allows using special symbols in the frame strings, like \n, \t.
 func (q *StringSettings) SetEscapeSymbol(symbol byte) *StringSettings {
+	q.mutable()
 	q.EscapeSymbol = symbol
+	q.classify()
 	return q
 }
 
@@ -110,32 +227,80 @@ func (q *StringSettings) SetEscapeSymbol(symbol byte) *StringSettings {
 //
 // Deprecated: use AddSpecialStrings
 func (q *StringSettings) SetSpecialSymbols(special map[byte]byte) *StringSettings {
+	q.mutable()
 	for _, v := range special {
 		q.SpecSymbols = append(q.SpecSymbols, []byte{v})
 	}
+	q.classify()
 	return q
 }
 
 // AddSpecialStrings set mapping of all escapable strings for escape symbol, like \n, \t, \r.
 func (q *StringSettings) AddSpecialStrings(special []string) *StringSettings {
+	q.mutable()
 	for _, s := range special {
 		q.SpecSymbols = append(q.SpecSymbols, []byte(s))
 	}
+	q.classify()
 	return q
 }
 
+// NumberFormat describes locale-specific format of numbers.
+type NumberFormat struct {
+	// DecimalSeparator separates integer and fractional parts of a number, '.' by default.
+	DecimalSeparator byte
+	// GroupSeparators separates digit groups in the integer part of a number, like `'` in 1'234.56
+	GroupSeparators []byte
+}
+
+// normalize converts number in the format to the form that strconv understands.
+func (f *NumberFormat) normalize(number []byte) []byte {
+	result := make([]byte, 0, len(number))
+	for _, c := range number {
+		if c == f.DecimalSeparator {
+			result = append(result, '.')
+		} else if bytes.IndexByte(f.GroupSeparators, c) == -1 {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
 // Tokenizer stores all token configuration and behaviors.
 type Tokenizer struct {
+	compiled              bool
 	stopOnUnknown         bool
 	allowNumberUnderscore bool
+	rejectUnknownSuffixes bool
+	allowNumberSign       bool
+	maximalMunch          bool
 	// all defined custom tokens {key: [token1, token2, ...], ...}
-	tokens         map[TokenKey][]*tokenRef
-	index          map[byte][]*tokenRef
+	tokens map[TokenKey][]*tokenRef
+	// keys of custom tokens in order of definition
+	keys           []TokenKey
+	trie           tokenTrie
+	classes        [256]byteClass
 	quotes         []*StringSettings
 	wSpaces        []byte
 	kwMajorSymbols []rune
 	kwMinorSymbols []rune
-	pool           sync.Pool
+	// number suffixes sorted by length, the longest first
+	numberSuffixes [][]byte
+	// keys of user tokens after which a sign is not a part of a number
+	operandKeys []TokenKey
+	// nil means default number format
+	numberFormat *NumberFormat
+	// names of user keys for debug output
+	names map[TokenKey]string
+	// order of categories, nil means default order with signed numbers first
+	categories []Category
+	// pairs of brackets, see DefineBrackets
+	brackets []BracketPair
+	// channels of keys, tokens of other keys are in ChannelDefault, see SetChannel
+	channels map[TokenKey]Channel
+	// definitions ignored by DefineTokens, DefineStringToken, DefineBrackets and SetChannel
+	rejected []rejection
+	pool     sync.Pool
 }
 
 // New creates new tokenizer.
@@ -143,20 +308,84 @@ func New() *Tokenizer {
 	t := Tokenizer{
 		// flags:   0,
 		tokens:  map[TokenKey][]*tokenRef{},
-		index:   map[byte][]*tokenRef{},
 		quotes:  []*StringSettings{},
 		wSpaces: DefaultWhiteSpaces,
 	}
 	t.pool.New = func() interface{} {
 		return new(Token)
 	}
+	t.classify()
 	return &t
 }
 
+// Compile validates the configuration (see Validate), detaches it from data shared with the caller,
+// rebuilds lookup tables and freezes the tokenizer.
+// The compiled tokenizer is immutable and safe for concurrent use:
+// many goroutines may call ParseString, ParseBytes and ParseStream at the same time.
+// Any configuration method of the compiled tokenizer or its StringSettings panics.
+// The tokenizer parses frozen copies of StringSettings, so changes of exported fields of settings
+// returned by DefineStringToken have no effect after compilation.
+//
+// Not compiled tokenizer is also safe for concurrent parsing, but only while nobody changes it.
+func (t *Tokenizer) Compile() (*Tokenizer, error) {
+	if t.compiled {
+		return t, nil
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	// detach slices that may be shared with the caller
+	t.wSpaces = append([]byte(nil), t.wSpaces...)
+	t.kwMajorSymbols = append([]rune(nil), t.kwMajorSymbols...)
+	t.kwMinorSymbols = append([]rune(nil), t.kwMinorSymbols...)
+	if t.numberFormat != nil {
+		t.numberFormat.GroupSeparators = append([]byte(nil), t.numberFormat.GroupSeparators...)
+	}
+	for i, q := range t.quotes {
+		q.frozen = true
+		t.quotes[i] = q.snapshot()
+	}
+	t.classify()
+	t.compiled = true
+	return t, nil
+}
+
+// MustCompile is like Compile but panics if the configuration is invalid.
+func (t *Tokenizer) MustCompile() *Tokenizer {
+	if _, err := t.Compile(); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// IsCompiled checks if the tokenizer is compiled and immutable.
+func (t *Tokenizer) IsCompiled() bool {
+	return t.compiled
+}
+
+// mutable panics if the tokenizer is compiled.
+func (t *Tokenizer) mutable() {
+	if t.compiled {
+		panic(errCompiled)
+	}
+}
+
+// validate returns the first error of the configuration, see Validate.
+func (t *Tokenizer) validate() error {
+	for _, problem := range t.Validate() {
+		if problem.Level == ProblemError {
+			return errors.New(problem.Message)
+		}
+	}
+	return nil
+}
+
 // SetWhiteSpaces sets custom whitespace symbols between tokens.
 // By default: `{' ', '\t', '\n', '\r'}`
 func (t *Tokenizer) SetWhiteSpaces(ws []byte) *Tokenizer {
+	t.mutable()
 	t.wSpaces = ws
+	t.classify()
 	return t
 }
 
@@ -171,8 +400,10 @@ func (t *Tokenizer) SetWhiteSpaces(ws []byte) *Tokenizer {
 //
 // Beware, the tokenizer does not control consecutive duplicates of these runes.
 func (t *Tokenizer) AllowKeywordSymbols(majorSymbols []rune, minorSymbols []rune) *Tokenizer {
+	t.mutable()
 	t.kwMajorSymbols = majorSymbols
 	t.kwMinorSymbols = minorSymbols
+	t.classify()
 	return t
 }
 
@@ -180,7 +411,9 @@ func (t *Tokenizer) AllowKeywordSymbols(majorSymbols []rune, minorSymbols []rune
 //
 // Deprecated: use AllowKeywordSymbols
 func (t *Tokenizer) AllowKeywordUnderscore() *Tokenizer {
+	t.mutable()
 	t.kwMajorSymbols = append(t.kwMajorSymbols, '_')
+	t.classify()
 	return t
 }
 
@@ -190,50 +423,218 @@ func (t *Tokenizer) AllowKeywordUnderscore() *Tokenizer {
 //
 // Deprecated: use AllowKeywordSymbols
 func (t *Tokenizer) AllowNumbersInKeyword() *Tokenizer {
+	t.mutable()
 	t.kwMinorSymbols = append(t.kwMinorSymbols, Numbers...)
+	t.classify()
 	return t
 }
 
 // StopOnUndefinedToken stops parsing if unknown token detected.
 func (t *Tokenizer) StopOnUndefinedToken() *Tokenizer {
+	t.mutable()
 	t.stopOnUnknown = true
 	return t
 }
 
 // AllowNumberUnderscore allows underscore symbol in numbers, like `1_000`
 func (t *Tokenizer) AllowNumberUnderscore() *Tokenizer {
+	t.mutable()
 	t.allowNumberUnderscore = true
 	return t
 }
 
+// SetNumberFormat sets locale-specific decimal separator and group separators of numbers.
+// For example, `SetNumberFormat(',', []byte{'.', ' '})` allows `1.234,56` and `1 234,56`,
+// `SetNumberFormat('.', []byte("'"))` allows `1'234.56`.
+// Group separators are allowed only between digits of the integer part.
+// If the decimal separator is not '.' it is allowed only between digits, so `1,` and `,5` are not numbers.
+// This resolves ambiguity with the comma token: `f(1,5)` contains the number 1.5, but `f(1, 5)` contains two numbers.
+// Numeric getters of the token (like Token.ValueFloat64) honour the format.
+// Beware, if a whitespace is a group separator then `1 2` is parsed as the number 12.
+func (t *Tokenizer) SetNumberFormat(decimalSeparator byte, groupSeparators []byte) *Tokenizer {
+	t.mutable()
+	t.numberFormat = &NumberFormat{
+		DecimalSeparator: decimalSeparator,
+		GroupSeparators:  groupSeparators,
+	}
+	t.classify()
+	return t
+}
+
+// decimalSeparator returns current decimal separator of numbers.
+func (t *Tokenizer) decimalSeparator() byte {
+	if t.numberFormat != nil {
+		return t.numberFormat.DecimalSeparator
+	}
+	return '.'
+}
+
+// AllowSignedNumbers allows leading sign `-` or `+` as a part of a number, like `-12.5` or `+3`.
+// The sign is absorbed only if the previous token is not an operand: a number, a keyword, a string,
+// a close bracket (see DefineBrackets) or one of `operandKeys`. So `a-1` and `(b)-1` remain subtractions,
+// but `x = -1` and `[-1, -2]` contain signed numbers. Tokens of channels other than ChannelDefault, like comments
+// (see SetChannel), are skipped, so `x = /* c */ -1` contains the signed number too.
+// Signed numbers have priority over user tokens `-` and `+`.
+func (t *Tokenizer) AllowSignedNumbers(operandKeys ...TokenKey) *Tokenizer {
+	t.mutable()
+	t.allowNumberSign = true
+	t.operandKeys = append(t.operandKeys, operandKeys...)
+	t.classify()
+	return t
+}
+
+// AllowNumberSuffixes allows suffixes (units) right after numbers, like `10ms`, `5GiB`, `1.5f` or `42u8`.
+// The suffix is captured into the number token, see Token.NumberSuffix.
+// The suffix must not be followed by letters, digits or keyword symbols,
+// so `10msec` is not matched by suffix `ms`.
+func (t *Tokenizer) AllowNumberSuffixes(suffixes []string) *Tokenizer {
+	t.mutable()
+	for _, suffix := range suffixes {
+		if len(suffix) > 0 {
+			t.numberSuffixes = append(t.numberSuffixes, s2b(suffix))
+		}
+	}
+	sort.SliceStable(t.numberSuffixes, func(i, j int) bool {
+		return len(t.numberSuffixes[i]) > len(t.numberSuffixes[j])
+	})
+	return t
+}
+
+// RejectUnknownNumberSuffixes reports a diagnostic (see Stream.Diagnostics) if a number is followed
+// by a word that is not an allowed suffix, like `10xyz`.
+// The number and the word are still parsed as separate tokens.
+func (t *Tokenizer) RejectUnknownNumberSuffixes() *Tokenizer {
+	t.mutable()
+	t.rejectUnknownSuffixes = true
+	return t
+}
+
 // DefineTokens add custom token.
 // The `key` is the identifier of `tokens`, `tokens` — slice of tokens as string.
 // If a key already exists, tokens will be rewritten.
+// If the same token is defined for different keys, the first defined key wins.
+// Tokens with key < 1 are ignored and reported by Validate until the next DefineTokens or UndefineTokens of the key.
+// Empty tokens are ignored. If there are no tokens the key is undefined, see UndefineTokens.
 func (t *Tokenizer) DefineTokens(key TokenKey, tokens []string) *Tokenizer {
+	t.mutable()
 	var tks []*tokenRef
-	if key < 1 {
-		return t
-	}
 	for _, token := range tokens {
-		ref := tokenRef{
+		if len(token) == 0 {
+			continue
+		}
+		tks = append(tks, &tokenRef{
 			Key:   key,
 			Token: s2b(token),
+		})
+	}
+	if len(tks) == 0 {
+		return t.UndefineTokens(key)
+	}
+	if key < 1 {
+		t.reject("DefineTokens", Problem{
+			Level:   ProblemError,
+			Key:     key,
+			Message: fmt.Sprintf("tokens of key %s are ignored: key must be positive", t.KeyName(key)),
+		})
+		return t
+	}
+	if _, exists := t.tokens[key]; exists {
+		t.tokens[key] = tks
+		t.buildTrie()
+	} else {
+		t.tokens[key] = tks
+		t.keys = append(t.keys, key)
+		for _, ref := range tks {
+			t.trie.insert(ref)
 		}
-		head := ref.Token[0]
-		tks = append(tks, &ref)
-		if t.index[head] == nil {
-			t.index[head] = []*tokenRef{}
+	}
+
+	t.classify()
+	return t
+}
+
+// UndefineTokens removes custom tokens with the key.
+// UndefineTokens also forgets tokens of the key ignored by DefineTokens, see Validate.
+func (t *Tokenizer) UndefineTokens(key TokenKey) *Tokenizer {
+	t.mutable()
+	t.retract("DefineTokens", key)
+	if _, exists := t.tokens[key]; !exists {
+		return t
+	}
+	delete(t.tokens, key)
+	for i, k := range t.keys {
+		if k == key {
+			t.keys = append(t.keys[:i:i], t.keys[i+1:]...)
+			break
+		}
+	}
+	t.buildTrie()
+	t.classify()
+	return t
+}
+
+// buildTrie rebuilds the prefix tree of custom tokens in order of definition.
+func (t *Tokenizer) buildTrie() {
+	t.trie = tokenTrie{}
+	for _, key := range t.keys {
+		for _, ref := range t.tokens[key] {
+			t.trie.insert(ref)
 		}
-		t.index[head] = append(t.index[head], &ref)
-		sort.Slice(t.index[head], func(i, j int) bool {
-			return len(t.index[head][i].Token) > len(t.index[head][j].Token)
-		})
 	}
-	t.tokens[key] = tks
+}
+
+// Keys returns keys of custom tokens in order of definition.
+func (t *Tokenizer) Keys() []TokenKey {
+	return append([]TokenKey(nil), t.keys...)
+}
 
+// NameKey sets the name of the key for debug output, like `t.NameKey(TComma, "TComma")`.
+// The name is also used by TokenKey.String.
+// Empty name removes the name of the key.
+func (t *Tokenizer) NameKey(key TokenKey, name string) *Tokenizer {
+	t.mutable()
+	keyNames.Lock()
+	defer keyNames.Unlock()
+	if name == "" {
+		if old, ok := t.names[key]; ok && keyNames.names[key] == old {
+			delete(keyNames.names, key)
+		}
+		delete(t.names, key)
+		return t
+	}
+	if t.names == nil {
+		t.names = map[TokenKey]string{}
+	}
+	t.names[key] = name
+	keyNames.names[key] = name
 	return t
 }
 
+// KeyName returns the name of the key set by NameKey of the tokenizer or the name of the built-in key.
+// If the key has no name, method returns TokenKey(N).
+func (t *Tokenizer) KeyName(key TokenKey) string {
+	if name, ok := t.names[key]; ok {
+		return name
+	}
+	if name, ok := builtinKeyNames[key]; ok {
+		return name
+	}
+	return key.number()
+}
+
+// Tokens returns custom tokens of the key. If the key is not defined method returns nil.
+func (t *Tokenizer) Tokens(key TokenKey) []string {
+	refs := t.tokens[key]
+	if refs == nil {
+		return nil
+	}
+	tokens := make([]string, len(refs))
+	for i, ref := range refs {
+		tokens[i] = string(ref.Token)
+	}
+	return tokens
+}
+
 // DefineStringToken defines a token string.
 // For example, a piece of data surrounded by quotes: "string in quotes" or 'string on single quotes'.
 // Arguments startToken and endToken defines open and close "quotes".
@@ -243,22 +644,56 @@ func (t *Tokenizer) DefineTokens(key TokenKey, tokens []string) *Tokenizer {
 //
 //   - `t.DefineStringToken(11, "//", "\n")` - parse string "parse // like comment\n" will be parsed as
 //     [{key: TokenKeyword, value: "parse"}, {key: TokenString, value: "// like comment"}]
+//
+// The string with empty start token is ignored and reported by Validate until the next definition of the key.
 func (t *Tokenizer) DefineStringToken(key TokenKey, startToken, endToken string) *StringSettings {
+	t.mutable()
 	q := &StringSettings{
 		Key:        key,
 		StartToken: s2b(startToken),
 		EndToken:   s2b(endToken),
+		tokenizer:  t,
 	}
 	if q.StartToken == nil {
+		t.reject("DefineStringToken", Problem{
+			Level:   ProblemError,
+			Key:     key,
+			Message: fmt.Sprintf("string %s is ignored: empty start token", t.KeyName(key)),
+		})
 		return q
 	}
+	t.retract("DefineStringToken", key)
 	t.quotes = append(t.quotes, q)
 
+	t.classify()
 	return q
 }
 
+// UndefineString removes all framed strings with the key.
+// UndefineString also forgets strings of the key ignored by DefineStringToken, see Validate.
+func (t *Tokenizer) UndefineString(key TokenKey) *Tokenizer {
+	t.mutable()
+	t.retract("DefineStringToken", key)
+	quotes := t.quotes[:0:0]
+	for _, q := range t.quotes {
+		if q.Key != key {
+			quotes = append(quotes, q)
+		}
+	}
+	t.quotes = quotes
+	t.classify()
+	return t
+}
+
+// Strings returns settings of all framed strings in order of definition.
+func (t *Tokenizer) Strings() []*StringSettings {
+	return append([]*StringSettings(nil), t.quotes...)
+}
+
 func (t *Tokenizer) allocToken() *Token {
-	return t.pool.Get().(*Token)
+	token := t.pool.Get().(*Token)
+	token.tokenizer = t
+	return token
 }
 
 func (t *Tokenizer) freeToken(token *Token) {
@@ -271,6 +706,16 @@ func (t *Tokenizer) freeToken(token *Token) {
 	token.id = 0
 	token.key = 0
 	token.string = nil
+	token.suffix = 0
+	token.format = nil
+	token.tokenizer = nil
+	token.flags = 0
+	if token.pair != nil && token.pair.pair == token {
+		token.pair.pair = nil
+	}
+	token.pair = nil
+	token.depth = 0
+	token.channel = ChannelDefault
 	t.pool.Put(token)
 }
 
@@ -283,6 +728,7 @@ func (t *Tokenizer) ParseString(str string) *Stream {
 func (t *Tokenizer) ParseBytes(str []byte) *Stream {
 	p := newParser(t, str)
 	p.parse()
+	p.closeBrackets()
 	return NewStream(p)
 }
 
@@ -290,6 +736,6 @@ func (t *Tokenizer) ParseBytes(str []byte) *Stream {
 func (t *Tokenizer) ParseStream(r io.Reader, bufferSize uint) *Stream {
 	p := newInfParser(t, r, bufferSize)
 	p.preload()
-	p.parse()
+	p.parseNext()
 	return NewInfStream(p)
 }
@@ -2,8 +2,11 @@ package tokenizer
 
 import (
 	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -79,6 +82,47 @@ func TestTokenize(t *testing.T) {
 		}
 	})
 
+	t.Run("decimals", func(t *testing.T) {
+		decimals := []struct {
+			value string
+			coef  string
+			exp   int
+			rat   string
+		}{
+			{"0.1", "1", -1, "1/10"},
+			{"1.25e-3", "125", -5, "1/800"},
+			{"1_000.50", "100050", -2, "2001/2"},
+			{"2.3E+4", "23", 3, "23000"},
+			{"2.", "2", 0, "2"},
+			{".2", "2", -1, "1/5"},
+			{"123_456", "123456", 0, "123456"},
+		}
+		for _, v := range decimals {
+			t.Run(v.value, func(t *testing.T) {
+				stream := tokenizer.ParseString(v.value)
+				coef, exp := stream.CurrentToken().ValueDecimal()
+				require.NotNil(t, coef)
+				require.Equal(t, v.coef, coef.String())
+				require.Equal(t, v.exp, exp)
+				require.Equal(t, v.rat, stream.CurrentToken().ValueRat().RatString())
+			})
+		}
+
+		stream := tokenizer.ParseString("one")
+		coef, exp := stream.CurrentToken().ValueDecimal()
+		require.Nil(t, coef)
+		require.Equal(t, 0, exp)
+		require.Nil(t, stream.CurrentToken().ValueRat())
+
+		// huge exponents are not expanded
+		stream = tokenizer.ParseString("1e999999999 1.5e-9999")
+		coef, exp = stream.CurrentToken().ValueDecimal()
+		require.Equal(t, "1", coef.String())
+		require.Equal(t, 999999999, exp)
+		require.Nil(t, stream.CurrentToken().ValueRat())
+		require.Equal(t, "3/2"+strings.Repeat("0", 9999), stream.GoNext().CurrentToken().ValueRat().RatString())
+	})
+
 	t.Run("framed", func(t *testing.T) {
 		framed := []item{
 			{"one", Token{key: TokenString, string: quote, value: []byte("\"one\"")}},
@@ -160,7 +204,7 @@ func TestTokenizeEdgeCases(t *testing.T) {
 		for _, v := range data1 {
 			t.Run(v.str, func(t *testing.T) {
 				stream := tokenizer.ParseString(v.str)
-				require.Equalf(t, v.tokens, stream.GetSnippet(10, 10), "parse data1 %s: %s", v.str, stream)
+				require.Equalf(t, v.tokens, detached(stream.GetSnippet(10, 10)), "parse data1 %s: %s", v.str, stream)
 			})
 		}
 	})
@@ -181,7 +225,7 @@ func TestTokenizeEdgeCases(t *testing.T) {
 
 		for _, v := range data2 {
 			stream := tokenizer.ParseBytes([]byte(v.str))
-			require.Equalf(t, v.tokens, stream.GetSnippet(10, 10), "parse data2 %s: %s", v.str, stream)
+			require.Equalf(t, v.tokens, detached(stream.GetSnippet(10, 10)), "parse data2 %s: %s", v.str, stream)
 		}
 	})
 }
@@ -290,7 +334,7 @@ func TestTokenizeComplex(t *testing.T) {
 			string: quote2,
 			line:   2,
 		},
-	}, stream.GetSnippet(10, 100), "parsed %s as \n%s", str, stream)
+	}, detached(stream.GetSnippet(10, 100)), "parsed %s as \n%s", str, stream)
 }
 
 func TestTokenizeInject(t *testing.T) {
@@ -323,6 +367,7 @@ func TestTokenizeInject(t *testing.T) {
 			value:  []byte("{{"),
 			offset: 5,
 			indent: nil,
+			flags:  flagInjectionStart,
 			line:   1,
 		},
 		{
@@ -339,6 +384,7 @@ func TestTokenizeInject(t *testing.T) {
 			value:  []byte("}}"),
 			offset: 12,
 			indent: []byte(" "),
+			flags:  flagInjectionEnd,
 			line:   1,
 		},
 		{
@@ -350,7 +396,7 @@ func TestTokenizeInject(t *testing.T) {
 			string: quote,
 			line:   1,
 		},
-	}, stream.GetSnippet(10, 10), "parsed %s as %s", str, stream)
+	}, detached(stream.GetSnippet(10, 10)), "parsed %s as %s", str, stream)
 }
 
 func FuzzStream(f *testing.F) {
@@ -407,3 +453,764 @@ func FuzzStream(f *testing.F) {
 		}
 	})
 }
+
+func TestTokenizeInjectChunks(t *testing.T) {
+	tokenizer := New()
+	tokenizer.DefineTokens(10, []string{"{"}).DefineTokens(11, []string{"}"})
+	tokenizer.DefineStringToken(12, `"`, `"`).AddInjection(10, 11)
+	for pad := 0; pad < 8; pad++ {
+		source := strings.Repeat(" ", pad) + `"x{17 "y{a}"}" }`
+		expected := streamValues(tokenizer.ParseString(source))
+		for size := uint(1); size < 12; size++ {
+			require.Equal(t, expected, streamValues(tokenizer.ParseStream(strings.NewReader(source), size)), "pad %d, chunk %d", pad, size)
+		}
+	}
+}
+
+func TestNumberSuffixes(t *testing.T) {
+	tokenizer := New()
+	tokenizer.AllowNumberUnderscore()
+	tokenizer.AllowNumberSuffixes([]string{"ms", "s", "GiB", "f", "L", "i", "u8", "px"})
+
+	t.Run("captured", func(t *testing.T) {
+		data := []struct {
+			str    string
+			key    TokenKey
+			suffix string
+			number float64
+		}{
+			{"10ms", TokenInteger, "ms", 10},
+			{"10s", TokenInteger, "s", 10},
+			{"5GiB", TokenInteger, "GiB", 5},
+			{"1.5f", TokenFloat, "f", 1.5},
+			{"100L", TokenInteger, "L", 100},
+			{"3i", TokenInteger, "i", 3},
+			{"42u8", TokenInteger, "u8", 42},
+			{"1_200px", TokenInteger, "px", 1200},
+			{"2.5e3ms", TokenFloat, "ms", 2500},
+		}
+		for _, v := range data {
+			t.Run(v.str, func(t *testing.T) {
+				stream := tokenizer.ParseString(v.str)
+				require.Equal(t, v.key, stream.CurrentToken().Key())
+				require.Equal(t, v.str, stream.CurrentToken().ValueString())
+				require.Equal(t, []byte(v.suffix), stream.CurrentToken().NumberSuffix())
+				require.Equal(t, v.number, stream.CurrentToken().ValueFloat64())
+				require.Equal(t, int64(v.number), stream.CurrentToken().ValueInt64())
+				require.False(t, stream.GoNext().IsValid())
+			})
+		}
+	})
+
+	t.Run("separated", func(t *testing.T) {
+		stream := tokenizer.ParseString("10 ms 10msec 7")
+		require.Equal(t, []Token{
+			{key: TokenInteger, value: s2b("10"), offset: 0, line: 1, id: 0},
+			{key: TokenKeyword, value: s2b("ms"), offset: 3, line: 1, id: 1, indent: s2b(" ")},
+			{key: TokenInteger, value: s2b("10"), offset: 6, line: 1, id: 2, indent: s2b(" ")},
+			{key: TokenKeyword, value: s2b("msec"), offset: 8, line: 1, id: 3},
+			{key: TokenInteger, value: s2b("7"), offset: 13, line: 1, id: 4, indent: s2b(" ")},
+		}, detached(stream.GetSnippet(0, 10)))
+		require.Nil(t, stream.CurrentToken().NumberSuffix())
+		require.Empty(t, stream.Diagnostics())
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		tokenizer.RejectUnknownNumberSuffixes()
+		stream := tokenizer.ParseString("10ms 10msec\n7xyz")
+		require.Equal(t, []Diagnostic{
+			{Line: 1, Offset: 7, Message: `unknown number suffix "msec"`},
+			{Line: 2, Offset: 13, Message: `unknown number suffix "xyz"`},
+		}, stream.Diagnostics())
+		require.Equal(t, []byte("ms"), stream.CurrentToken().NumberSuffix())
+		require.Equal(t, TokenKeyword, stream.GoNext().GoNext().CurrentToken().Key())
+	})
+}
+
+func TestSignedNumbers(t *testing.T) {
+	minusKey := TokenKey(10)
+	openKey := TokenKey(11)
+	closeKey := TokenKey(12)
+	commaKey := TokenKey(13)
+	tokenizer := New()
+	tokenizer.AllowSignedNumbers(closeKey)
+	tokenizer.DefineTokens(minusKey, []string{"-", "+"})
+	tokenizer.DefineTokens(openKey, []string{"("})
+	tokenizer.DefineTokens(closeKey, []string{")"})
+	tokenizer.DefineTokens(commaKey, []string{","})
+
+	data := []struct {
+		str  string
+		keys []TokenKey
+	}{
+		{"-12.5", []TokenKey{TokenFloat}},
+		{"+3", []TokenKey{TokenInteger}},
+		{"-.5", []TokenKey{TokenFloat}},
+		{"a-1", []TokenKey{TokenKeyword, minusKey, TokenInteger}},
+		{"a - 1", []TokenKey{TokenKeyword, minusKey, TokenInteger}},
+		{"1-1", []TokenKey{TokenInteger, minusKey, TokenInteger}},
+		{"(b)-1", []TokenKey{openKey, TokenKeyword, closeKey, minusKey, TokenInteger}},
+		{"(-1,-2)", []TokenKey{openKey, TokenInteger, commaKey, TokenInteger, closeKey}},
+		{"- 1", []TokenKey{minusKey, TokenInteger}},
+		{"--1", []TokenKey{minusKey, TokenInteger}},
+		{"-a", []TokenKey{minusKey, TokenKeyword}},
+	}
+	for _, v := range data {
+		t.Run(v.str, func(t *testing.T) {
+			require.Equal(t, v.keys, streamKeys(tokenizer.ParseString(v.str)))
+		})
+	}
+
+	stream := tokenizer.ParseString("-12.5, +3, -1.25e-3")
+	require.Equal(t, "-12.5", stream.CurrentToken().ValueString())
+	require.Equal(t, -12.5, stream.CurrentToken().ValueFloat64())
+	require.Equal(t, int64(3), stream.GoNext().GoNext().CurrentToken().ValueInt64())
+	coef, exp := stream.GoNext().GoNext().CurrentToken().ValueDecimal()
+	require.Equal(t, "-125", coef.String())
+	require.Equal(t, -5, exp)
+
+	stream = New().ParseString("-1")
+	require.Equal(t, TokenUnknown, stream.CurrentToken().Key())
+
+	commentKey := TokenKey(14)
+	tokenizer = New().AllowSignedNumbers()
+	tokenizer.DefineTokens(minusKey, []string{"-"}).DefineTokens(openKey, []string{"("}).DefineTokens(closeKey, []string{")"})
+	tokenizer.DefineBrackets(openKey, closeKey)
+	tokenizer.DefineStringToken(commentKey, "/*", "*/")
+	tokenizer.SetChannel(ChannelHidden, commentKey)
+	// close brackets are operands
+	require.Equal(t, []TokenKey{openKey, TokenKeyword, closeKey, minusKey, TokenInteger}, streamKeys(tokenizer.ParseString("(a) -1")))
+	// hidden tokens are skipped
+	require.Equal(t, []TokenKey{openKey, TokenInteger, closeKey}, streamKeys(tokenizer.ParseString("(/* c */ -1)")))
+	require.Equal(t, []TokenKey{TokenKeyword, minusKey, TokenInteger}, streamKeys(tokenizer.ParseString("a /* c */ -1")))
+}
+
+func TestNumberFormat(t *testing.T) {
+	commaKey := TokenKey(10)
+	openKey := TokenKey(11)
+	closeKey := TokenKey(12)
+
+	t.Run("locales", func(t *testing.T) {
+		data := []struct {
+			str     string
+			decimal byte
+			groups  []byte
+			key     TokenKey
+			value   float64
+			coef    string
+			exp     int
+		}{
+			{"1.234,56", ',', []byte{'.'}, TokenFloat, 1234.56, "123456", -2},
+			{"1 234,56", ',', []byte{' '}, TokenFloat, 1234.56, "123456", -2},
+			{"1'234.56", '.', []byte{'\''}, TokenFloat, 1234.56, "123456", -2},
+			{"1'234'567", '.', []byte{'\''}, TokenInteger, 1234567, "1234567", 0},
+			{"1.234", ',', []byte{'.'}, TokenInteger, 1234, "1234", 0},
+			{"2,5e3", ',', nil, TokenFloat, 2500, "25", 2},
+		}
+		for _, v := range data {
+			t.Run(v.str, func(t *testing.T) {
+				tokenizer := New().SetNumberFormat(v.decimal, v.groups)
+				stream := tokenizer.ParseString(v.str)
+				require.Equal(t, v.key, stream.CurrentToken().Key())
+				require.Equal(t, v.str, stream.CurrentToken().ValueString())
+				require.Equal(t, v.value, stream.CurrentToken().ValueFloat64())
+				require.Equal(t, int64(v.value), stream.CurrentToken().ValueInt64())
+				coef, exp := stream.CurrentToken().ValueDecimal()
+				require.Equal(t, v.coef, coef.String())
+				require.Equal(t, v.exp, exp)
+				require.False(t, stream.GoNext().IsValid())
+			})
+		}
+	})
+
+	t.Run("comma", func(t *testing.T) {
+		tokenizer := New().SetNumberFormat(',', []byte{'.'})
+		tokenizer.DefineTokens(commaKey, []string{","})
+		tokenizer.DefineTokens(openKey, []string{"("})
+		tokenizer.DefineTokens(closeKey, []string{")"})
+		data := []struct {
+			str  string
+			keys []TokenKey
+		}{
+			{"f(1,5)", []TokenKey{TokenKeyword, openKey, TokenFloat, closeKey}},
+			{"f(1, 5)", []TokenKey{TokenKeyword, openKey, TokenInteger, commaKey, TokenInteger, closeKey}},
+			{"1,", []TokenKey{TokenInteger, commaKey}},
+			{",5", []TokenKey{commaKey, TokenInteger}},
+			{"1.", []TokenKey{TokenInteger, TokenUnknown}},
+		}
+		for _, v := range data {
+			t.Run(v.str, func(t *testing.T) {
+				require.Equal(t, v.keys, streamKeys(tokenizer.ParseString(v.str)))
+			})
+		}
+	})
+}
+
+func TestCompile(t *testing.T) {
+	commaKey := TokenKey(10)
+	openKey := TokenKey(11)
+	closeKey := TokenKey(12)
+	dquoteKey := TokenKey(14)
+
+	t.Run("invalid", func(t *testing.T) {
+		tokenizer := New()
+		tokenizer.DefineStringToken(dquoteKey, `"`, `"`).AddInjection(openKey, closeKey)
+		_, err := tokenizer.Compile()
+		require.EqualError(t, err, "string TokenKey(14): injection start key TokenKey(11) is not defined")
+		require.False(t, tokenizer.IsCompiled())
+
+		_, err = New().SetNumberFormat(',', []byte{','}).Compile()
+		require.EqualError(t, err, "invalid group separator ','")
+
+		require.Panics(t, func() {
+			tokenizer := New()
+			tokenizer.DefineStringToken(dquoteKey, `"`, "")
+			tokenizer.MustCompile()
+		})
+	})
+
+	t.Run("frozen", func(t *testing.T) {
+		tokenizer := New()
+		quote := tokenizer.DefineStringToken(dquoteKey, `"`, `"`)
+		compiled, err := tokenizer.Compile()
+		require.NoError(t, err)
+		require.Same(t, tokenizer, compiled)
+		require.True(t, compiled.IsCompiled())
+
+		require.PanicsWithValue(t, errCompiled, func() {
+			compiled.DefineTokens(commaKey, []string{","})
+		})
+		require.PanicsWithValue(t, errCompiled, func() {
+			compiled.AllowNumberUnderscore()
+		})
+		require.PanicsWithValue(t, errCompiled, func() {
+			quote.SetEscapeSymbol('\\')
+		})
+
+		// exported fields are detached from the compiled tokenizer
+		quote.EndToken = []byte("'")
+		stream := compiled.ParseString(`"a' b" c`)
+		require.Equal(t, `"a' b"`, stream.CurrentToken().ValueString())
+		require.Equal(t, []byte(`"`), stream.CurrentToken().StringSettings().EndToken)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		tokenizer := New()
+		tokenizer.DefineTokens(commaKey, []string{","})
+		tokenizer.DefineTokens(openKey, []string{"{"})
+		tokenizer.DefineTokens(closeKey, []string{"}"})
+		tokenizer.DefineStringToken(dquoteKey, `"`, `"`).SetEscapeSymbol('\\')
+		tokenizer.MustCompile()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					str := fmt.Sprintf(`{%d, "item %d", %d.5}`, i, j, j)
+					stream := tokenizer.ParseString(str)
+					assert.Equal(t, []TokenKey{openKey, TokenInteger, commaKey, TokenString, commaKey, TokenFloat, closeKey},
+						streamKeys(stream))
+					stream.Close()
+					stream = tokenizer.ParseStream(strings.NewReader(str), 8)
+					assert.Equal(t, 7, len(streamKeys(stream)))
+					stream.Close()
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func streamKeys(stream *Stream) []TokenKey {
+	var keys []TokenKey
+	for ; stream.IsValid(); stream.GoNext() {
+		keys = append(keys, stream.CurrentToken().Key())
+	}
+	return keys
+}
+
+func TestLongestMatch(t *testing.T) {
+	tokenizer := New()
+	tokenizer.DefineTokens(10, []string{"<", "<<", "<=", "<<="})
+	tokenizer.DefineTokens(11, []string{"<<<<", "->", "-->"})
+	tokenizer.DefineTokens(12, []string{"<=>", "-"})
+	str := "<<=<<<<<<=<=> <- -->--->"
+	expected := []string{"<<=", "<<<<", "<<=", "<=>", "<", "-", "-->", "-", "-->"}
+
+	for _, stream := range []*Stream{
+		tokenizer.ParseString(str),
+		tokenizer.ParseStream(strings.NewReader(str), 2),
+	} {
+		var values []string
+		for ; stream.IsValid(); stream.GoNext() {
+			values = append(values, stream.CurrentToken().ValueString())
+		}
+		require.Equal(t, expected, values)
+	}
+}
+
+func TestByteClasses(t *testing.T) {
+	tokenizer := New()
+	tokenizer.SetWhiteSpaces([]byte{' ', ';'})
+	tokenizer.AllowKeywordSymbols([]rune{'@', '§'}, []rune{'1', '-', '·'})
+	tokenizer.DefineTokens(10, []string{"-", "@@"})
+
+	require.NotZero(t, tokenizer.classes[';']&classSpace)
+	require.Zero(t, tokenizer.classes['\n']&classSpace)
+	require.NotZero(t, tokenizer.classes['@']&classKeyword)
+	require.NotZero(t, tokenizer.classes['-']&classKeywordTail)
+	require.NotZero(t, tokenizer.classes['-']&classToken)
+	require.Zero(t, tokenizer.classes['-']&classSign)
+
+	stream := tokenizer.ParseString("@a1-b;§x·1 - 1a @@ñ")
+	require.Equal(t, []byte(";"), stream.NextToken().Indent())
+	require.Equal(t, []string{"@a1-b", "§x·1", "-", "1", "a", "@@", "ñ"}, streamValues(stream))
+
+	tokenizer.AllowSignedNumbers()
+	require.NotZero(t, tokenizer.classes['-']&classSign)
+	require.Equal(t, []string{"-1", "-", "a"}, streamValues(tokenizer.ParseString("-1 - a")))
+}
+
+func streamValues(stream *Stream) []string {
+	var values []string
+	for ; stream.IsValid(); stream.GoNext() {
+		values = append(values, stream.CurrentToken().ValueString())
+	}
+	return values
+}
+
+// tokenValues returns values of the tokens.
+func tokenValues(tokens []*Token) []string {
+	var values []string
+	for _, token := range tokens {
+		values = append(values, token.ValueString())
+	}
+	return values
+}
+
+// streamPairs returns IDs of paired tokens and depths of tokens.
+// The stream is parsed till the end first: the pair of the open bracket is known when the close bracket is parsed.
+func streamPairs(stream *Stream) ([]int, []int) {
+	var ids, depths []int
+	for stream.IsValid() {
+		stream.GoNext()
+	}
+	stream.GoTo(0)
+	for ; stream.IsValid(); stream.GoNext() {
+		ids = append(ids, stream.CurrentToken().Pair().ID())
+		depths = append(depths, stream.CurrentToken().Depth())
+	}
+	return ids, depths
+}
+
+// streamIDs returns IDs of all tokens of the stream from the head, including hidden ones.
+func streamIDs(stream *Stream) []int {
+	var ids []int
+	for token := stream.HeadToken(); token != nil && token != undefToken; token = token.next {
+		ids = append(ids, token.ID())
+	}
+	return ids
+}
+
+// tokenInfo holds the fields of the token which are compared in tests of parallel parsing.
+type tokenInfo struct {
+	id, line, offset, suffix int
+	key                      TokenKey
+	value, indent            string
+	stringKey                TokenKey
+}
+
+// streamTokens returns all tokens of the stream from the head, including hidden ones.
+func streamTokens(stream *Stream) []tokenInfo {
+	var tokens []tokenInfo
+	for ptr := stream.HeadToken(); ptr != nil && ptr != undefToken; ptr = ptr.next {
+		tokens = append(tokens, tokenInfo{
+			id: ptr.id, line: ptr.line, offset: ptr.offset, suffix: ptr.suffix,
+			key: ptr.key, value: string(ptr.value), indent: string(ptr.indent), stringKey: ptr.StringKey(),
+		})
+	}
+	return tokens
+}
+
+func TestQuoteScanning(t *testing.T) {
+	tokenizer := New()
+	openKey := TokenKey(10)
+	closeKey := TokenKey(11)
+	dquoteKey := TokenKey(14)
+	commentKey := TokenKey(15)
+	blockKey := TokenKey(16)
+	tokenizer.DefineTokens(openKey, []string{"{{"})
+	tokenizer.DefineTokens(closeKey, []string{"}}"})
+	tokenizer.DefineStringToken(dquoteKey, `"`, `"`).SetEscapeSymbol('\\').AddInjection(openKey, closeKey)
+	tokenizer.DefineStringToken(commentKey, "//", "\n")
+	tokenizer.DefineStringToken(blockKey, "/*", "*/")
+
+	blob := strings.Repeat("QUJDRA==", 1000)
+	str := "a /* " + blob + "\n * two\n */ b // comment\nc \"x\\\"" + blob + "\\\n{{ d }}\" e \"{{f}}{{g}}\" h"
+
+	for _, stream := range []*Stream{
+		tokenizer.ParseString(str),
+		tokenizer.ParseStream(strings.NewReader(str), 64),
+	} {
+		type item struct {
+			key   TokenKey
+			value string
+			line  int
+		}
+		var items []item
+		for ; stream.IsValid(); stream.GoNext() {
+			value := stream.CurrentToken().ValueString()
+			if len(value) > 20 {
+				value = value[:10] + "..." + value[len(value)-10:]
+			}
+			items = append(items, item{stream.CurrentToken().Key(), value, stream.CurrentToken().Line()})
+		}
+		require.Equal(t, []item{
+			{TokenKeyword, "a", 1},
+			{TokenString, "/* QUJDRA=... * two\n */", 1},
+			{TokenKeyword, "b", 3},
+			{TokenString, "// comment\n", 3},
+			{TokenKeyword, "c", 4},
+			{TokenStringFragment, "\"x\\\"QUJDRA...QUJDRA==\\\n", 4},
+			{openKey, "{{", 5},
+			{TokenKeyword, "d", 5},
+			{closeKey, "}}", 5},
+			{TokenStringFragment, "\"", 5},
+			{TokenKeyword, "e", 5},
+			{TokenStringFragment, "\"", 5},
+			{openKey, "{{", 5},
+			{TokenKeyword, "f", 5},
+			{closeKey, "}}", 5},
+			{TokenStringFragment, "", 5},
+			{openKey, "{{", 5},
+			{TokenKeyword, "g", 5},
+			{closeKey, "}}", 5},
+			{TokenStringFragment, "\"", 5},
+			{TokenKeyword, "h", 5},
+		}, items)
+	}
+}
+
+// TestQuoteLines checks line numbers after strings which start and end tokens contain new lines.
+func TestQuoteLines(t *testing.T) {
+	tokenizer := New()
+	tokenizer.DefineStringToken(10, "#", "\n")
+	tokenizer.DefineStringToken(11, "<<\n", "\n>>")
+	str := "a # one\nb <<\ntwo\n>> c\n# three\n\nd"
+
+	for _, stream := range []*Stream{
+		tokenizer.ParseString(str),
+		tokenizer.ParseStream(strings.NewReader(str), 4),
+	} {
+		var lines []int
+		for ; stream.IsValid(); stream.GoNext() {
+			lines = append(lines, stream.CurrentToken().Line())
+		}
+		require.Equal(t, []int{1, 1, 2, 2, 4, 5, 7}, lines)
+	}
+}
+
+func TestQuoteFields(t *testing.T) {
+	t.Run("start token", func(t *testing.T) {
+		tokenizer := New()
+		quote := tokenizer.DefineStringToken(10, "'", "'")
+		quote.StartToken = []byte("`")
+		require.Equal(t, []string{"`a'", "b"}, streamValues(tokenizer.ParseString("`a' b")))
+		quote.StartToken = nil
+		tokenizer.DefineTokens(11, []string{"+"})
+		require.Equal(t, []string{"'", "a", "'"}, streamValues(tokenizer.ParseString("'a'")))
+		require.Equal(t, []Problem{{Level: ProblemError, Key: 10, Message: "string TokenKey(10): empty start token"}}, tokenizer.Validate())
+	})
+
+	t.Run("body", func(t *testing.T) {
+		tokenizer := New()
+		tokenizer.DefineTokens(11, []string{"{"}).DefineTokens(12, []string{"}"})
+		quote := tokenizer.DefineStringToken(10, "'", "'")
+		quote.EscapeSymbol = BackSlash
+		require.Equal(t, []string{`'a\'b'`, "c"}, streamValues(tokenizer.ParseString(`'a\'b' c`)))
+		quote.EndToken = []byte("!")
+		require.Equal(t, []string{"'ab!", "c"}, streamValues(tokenizer.ParseString("'ab! c")))
+		quote.EndToken = []byte("\n!")
+		stream := tokenizer.ParseString("'a\n! b")
+		require.Equal(t, 2, stream.GoNext().CurrentToken().Line())
+		quote.EndToken = []byte("'")
+		quote.Injects = []QuoteInjectSettings{{StartKey: 11, EndKey: 12}}
+		require.Equal(t, []string{"'a", "{", "b", "}", "'", "c"}, streamValues(tokenizer.ParseString("'a{b}' c")))
+	})
+}
+
+func TestTokensRegistry(t *testing.T) {
+	tokenizer := New()
+	tokenizer.DefineTokens(10, []string{"==", "="})
+	tokenizer.DefineTokens(11, []string{"<", ">"})
+	tokenizer.DefineTokens(12, []string{"<<"})
+	dquote := tokenizer.DefineStringToken(14, `"`, `"`)
+	squote := tokenizer.DefineStringToken(15, `'`, `'`)
+	tokenizer.DefineStringToken(14, "`", "`")
+
+	require.Equal(t, []TokenKey{10, 11, 12}, tokenizer.Keys())
+	require.Equal(t, []string{"==", "="}, tokenizer.Tokens(10))
+	require.Nil(t, tokenizer.Tokens(13))
+	require.Len(t, tokenizer.Strings(), 3)
+
+	t.Run("redefine", func(t *testing.T) {
+		tokenizer.DefineTokens(10, []string{"=>"})
+		require.Equal(t, []TokenKey{10, 11, 12}, tokenizer.Keys())
+		require.Equal(t, []string{"=>"}, tokenizer.Tokens(10))
+		require.Equal(t, []TokenKey{10, TokenUnknown, 11}, streamKeys(tokenizer.ParseString("=> = <")))
+
+		tokenizer.DefineTokens(13, []string{}).DefineTokens(13, []string{""})
+		require.Equal(t, []TokenKey{10, 11, 12}, tokenizer.Keys())
+	})
+
+	t.Run("undefine", func(t *testing.T) {
+		tokenizer.UndefineTokens(12)
+		tokenizer.UndefineTokens(13)
+		require.Equal(t, []TokenKey{10, 11}, tokenizer.Keys())
+		tokenizer.DefineTokens(11, nil)
+		require.Equal(t, []TokenKey{10}, tokenizer.Keys())
+		tokenizer.DefineTokens(11, []string{"<"})
+		require.Equal(t, []string{"<", "<"}, streamValues(tokenizer.ParseString("<<")))
+
+		tokenizer.UndefineString(14)
+		require.Equal(t, []*StringSettings{squote}, tokenizer.Strings())
+		require.Equal(t, []TokenKey{TokenUnknown, TokenKeyword, TokenUnknown, TokenString},
+			streamKeys(tokenizer.ParseString(`"a" 'b'`)))
+		require.NotContains(t, tokenizer.Strings(), dquote)
+	})
+}
+
+func TestCloneAndExtend(t *testing.T) {
+	equalKey := TokenKey(10)
+	castKey := TokenKey(11)
+	concatKey := TokenKey(12)
+	dquoteKey := TokenKey(13)
+	squoteKey := TokenKey(14)
+	btickKey := TokenKey(15)
+	base := New()
+	base.AllowKeywordSymbols(Underscore, Numbers)
+	base.DefineTokens(equalKey, []string{"=", "<>"})
+	base.DefineTokens(concatKey, []string{"||"})
+	base.DefineStringToken(dquoteKey, `"`, `"`).SetEscapeSymbol(BackSlash)
+	base.DefineStringToken(squoteKey, `'`, `'`)
+	base.MustCompile()
+
+	t.Run("clone", func(t *testing.T) {
+		postgres := base.Clone()
+		require.False(t, postgres.IsCompiled())
+		postgres.DefineTokens(castKey, []string{"::"})
+		postgres.AllowKeywordSymbols(nil, nil)
+		postgres.Strings()[0].SetEscapeSymbol(0)
+
+		require.Equal(t, []TokenKey{equalKey, concatKey, castKey}, postgres.Keys())
+		require.Equal(t, []TokenKey{equalKey, concatKey}, base.Keys())
+		require.Equal(t, []string{"a_1", "::", "int"}, streamValues(base.Clone().DefineTokens(castKey, []string{"::"}).ParseString("a_1::int")))
+		require.Equal(t, []string{"a", "_", "1", "::", "int"}, streamValues(postgres.ParseString("a_1::int")))
+		require.Equal(t, byte(BackSlash), base.Strings()[0].EscapeSymbol)
+		require.NotSame(t, base.Strings()[0], postgres.Strings()[0])
+		require.NotSame(t, base.tokens[equalKey][0], postgres.tokens[equalKey][0])
+		require.Same(t, postgres, postgres.Strings()[0].tokenizer)
+
+		quote := New().DefineStringToken(dquoteKey, `"`, `"`).AddSpecialStrings([]string{"n"})
+		clone := quote.tokenizer.Clone().Strings()[0]
+		clone.StartToken[0], clone.EndToken[0], clone.SpecSymbols[0][0] = '\'', '\'', 't'
+		require.Equal(t, []byte(`"`), quote.StartToken)
+		require.Equal(t, []byte(`"`), quote.EndToken)
+		require.Equal(t, []byte("n"), quote.SpecSymbols[0])
+	})
+
+	t.Run("extend", func(t *testing.T) {
+		layer := New()
+		layer.DefineTokens(equalKey, []string{"==", "="})
+		layer.DefineTokens(castKey, []string{"::"})
+		layer.DefineStringToken(dquoteKey, "`", "`")
+		layer.DefineStringToken(btickKey, "$$", "$$")
+
+		replaced := base.Clone()
+		require.NoError(t, replaced.Extend(layer, CollisionReplace))
+		require.Equal(t, []TokenKey{equalKey, concatKey, castKey}, replaced.Keys())
+		require.Equal(t, []string{"==", "="}, replaced.Tokens(equalKey))
+		require.Equal(t, []TokenKey{squoteKey, dquoteKey, btickKey}, stringKeys(replaced))
+		require.NotSame(t, layer.tokens[castKey][0], replaced.tokens[castKey][0])
+		require.NotSame(t, layer.Strings()[0], replaced.Strings()[1])
+
+		kept := base.Clone()
+		require.NoError(t, kept.Extend(layer, CollisionKeep))
+		require.Equal(t, []string{"=", "<>"}, kept.Tokens(equalKey))
+		require.Equal(t, []TokenKey{dquoteKey, squoteKey, btickKey}, stringKeys(kept))
+
+		merged := base.Clone()
+		require.NoError(t, merged.Extend(layer, CollisionMerge))
+		require.Equal(t, []string{"=", "<>", "=="}, merged.Tokens(equalKey))
+		require.Equal(t, []TokenKey{dquoteKey, squoteKey, dquoteKey, btickKey}, stringKeys(merged))
+		require.Equal(t, []TokenKey{TokenString, equalKey, TokenString, castKey, TokenString},
+			streamKeys(merged.ParseString("`a` == \"b\" :: $$c$$")))
+
+		failed := base.Clone()
+		require.EqualError(t, failed.Extend(layer, CollisionError), "tokens of key TokenKey(10) are already defined")
+		require.Equal(t, base.Keys(), failed.Keys())
+
+		require.Panics(t, func() {
+			_ = base.Extend(layer, CollisionKeep)
+		})
+	})
+}
+
+// detached removes the tokenizer from tokens of the snippet, so tokens may be compared with literals.
+func detached(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].tokenizer = nil
+	}
+	return tokens
+}
+
+func stringKeys(tokenizer *Tokenizer) []TokenKey {
+	var keys []TokenKey
+	for _, q := range tokenizer.Strings() {
+		keys = append(keys, q.Key)
+	}
+	return keys
+}
+
+func TestKeyNames(t *testing.T) {
+	const commaKey = TokenKey(10)
+	tokenizer := New()
+	tokenizer.DefineTokens(commaKey, []string{","}).NameKey(commaKey, "TComma")
+
+	require.Equal(t, "TokenKeyword", TokenKeyword.String())
+	require.Equal(t, "TokenUndef", TokenUndef.String())
+	require.Equal(t, "TComma", commaKey.String())
+	require.Equal(t, "TokenKey(99)", TokenKey(99).String())
+	require.Equal(t, "TComma", tokenizer.KeyName(commaKey))
+	require.Equal(t, "TokenInteger", tokenizer.KeyName(TokenInteger))
+	require.Equal(t, "TokenKey(11)", tokenizer.KeyName(11))
+
+	stream := tokenizer.ParseString("a, 1")
+	require.Equal(t, "TokenKeyword", stream.CurrentToken().KeyName())
+	require.Contains(t, stream.String(), "Key: TComma\n")
+	require.Contains(t, stream.String(), "Key: TokenInteger\n")
+	require.Equal(t, "TokenUndef", undefToken.KeyName())
+	snippet := stream.GoNext().GetSnippet(0, 1)
+	require.Equal(t, "TComma", snippet[0].KeyName())
+	require.Equal(t, "TokenInteger", snippet[1].KeyName())
+
+	require.Equal(t, "TComma", tokenizer.Clone().KeyName(commaKey))
+	require.Equal(t, "TokenKey(10)", tokenizer.NameKey(commaKey, "").KeyName(commaKey))
+	require.Equal(t, "TokenKey(10)", commaKey.String())
+}
+
+func TestValidate(t *testing.T) {
+	dotKey := TokenKey(10)
+	inKey := TokenKey(11)
+	quoteKey := TokenKey(12)
+	slashKey := TokenKey(13)
+	commentKey := TokenKey(14)
+	opKey := TokenKey(15)
+	dquoteKey := TokenKey(16)
+	tokenizer := New()
+	tokenizer.NameKey(inKey, "TIn")
+	tokenizer.DefineTokens(0, []string{"x"})
+	tokenizer.DefineTokens(dotKey, []string{".", "1x", "...", ".a"})
+	tokenizer.DefineTokens(inKey, []string{"in"})
+	tokenizer.DefineTokens(quoteKey, []string{`"`})
+	tokenizer.DefineTokens(slashKey, []string{"/", "##!"})
+	tokenizer.DefineTokens(opKey, []string{"+", "/", "+"})
+	tokenizer.DefineStringToken(dquoteKey, `"`, `"`)
+	tokenizer.DefineStringToken(commentKey, "//", "\n")
+	tokenizer.DefineStringToken(commentKey, "##", "\n")
+	tokenizer.DefineStringToken(dquoteKey, `"`, `'`)
+	tokenizer.DefineStringToken(dquoteKey, "", `'`)
+
+	var messages []string
+	for _, problem := range tokenizer.Validate() {
+		messages = append(messages, problem.String())
+	}
+	require.Equal(t, []string{
+		"error: tokens of key TokenUndef are ignored: key must be positive",
+		"error: string TokenKey(16) is ignored: empty start token",
+		"warning: string TokenKey(16) is unreachable: string TokenKey(16) has the same start token \"\\\"\"",
+		"warning: token \".\" of key TokenKey(10) shadows numbers which start with '.'",
+		"warning: token \"1x\" of key TokenKey(10) shadows numbers which start with '1'",
+		"warning: token \"in\" of key TIn shadows keywords which start with \"in\"",
+		"warning: token \"\\\"\" of key TokenKey(12) makes string TokenKey(16) unreachable: start token \"\\\"\" begins with the token",
+		"warning: token \"/\" of key TokenKey(13) makes string TokenKey(14) unreachable: start token \"//\" begins with the token",
+		"warning: token \"##!\" of key TokenKey(13) shadows string TokenKey(14) which starts with \"##\"",
+		"warning: token \"/\" of key TokenKey(15) is unreachable: key TokenKey(13) has the same token",
+		"warning: token \"+\" of key TokenKey(15) is duplicated",
+	}, messages)
+
+	_, err := tokenizer.Compile()
+	require.EqualError(t, err, "tokens of key TokenUndef are ignored: key must be positive")
+	require.Empty(t, New().DefineTokens(1, []string{"("}).DefineStringToken(2, `"`, `"`).tokenizer.Validate())
+	require.Empty(t, New().SetNumberFormat(',', nil).DefineTokens(1, []string{".", ".5"}).Validate())
+
+	t.Run("redefined", func(t *testing.T) {
+		tokenizer := New()
+		tokenizer.DefineTokens(0, []string{"x"}).DefineTokens(0, []string{"y"})
+		tokenizer.DefineStringToken(1, "", `"`)
+		tokenizer.DefineBrackets(2, 2)
+		require.Len(t, tokenizer.Validate(), 3)
+
+		tokenizer.DefineTokens(0, nil)
+		tokenizer.DefineStringToken(1, `"`, `"`)
+		tokenizer.DefineTokens(2, []string{"("}).DefineTokens(3, []string{")"}).DefineBrackets(2, 3)
+		require.Empty(t, tokenizer.Validate())
+		_, err := tokenizer.Compile()
+		require.NoError(t, err)
+	})
+}
+
+func TestPriorityAndMaximalMunch(t *testing.T) {
+	minusKey := TokenKey(10)
+	ordinalKey := TokenKey(11)
+	inKey := TokenKey(12)
+	dotKey := TokenKey(13)
+	commentKey := TokenKey(14)
+	base := func() *Tokenizer {
+		tokenizer := New()
+		tokenizer.DefineTokens(minusKey, []string{"-"})
+		tokenizer.DefineTokens(ordinalKey, []string{"1st"})
+		tokenizer.DefineTokens(inKey, []string{"in"})
+		tokenizer.DefineTokens(dotKey, []string{"."})
+		tokenizer.DefineStringToken(commentKey, "-->", "\n")
+		return tokenizer
+	}
+
+	t.Run("default", func(t *testing.T) {
+		require.Equal(t, []string{"-", "-", ">", "x", "1st", "in", "dex", ".", "5"},
+			streamValues(base().ParseString("--> x\n1st index .5")))
+		require.Equal(t, []Category{CategoryToken, CategoryKeyword, CategoryNumber, CategoryString}, base().Priority())
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		tokenizer := base().SetPriority(CategoryNumber, CategoryKeyword, CategoryNumber)
+		require.Equal(t, []Category{CategoryNumber, CategoryKeyword, CategoryToken, CategoryString}, tokenizer.Priority())
+		require.Equal(t, []string{"1", "st", "index", ".5", "-"},
+			streamValues(tokenizer.ParseString("1st index .5 -")))
+	})
+
+	t.Run("maximal munch", func(t *testing.T) {
+		tokenizer := base().UseMaximalMunch()
+		require.True(t, tokenizer.IsMaximalMunch())
+		stream := tokenizer.ParseString("--> x\n1st index in .5 . 1 -")
+		require.Equal(t, []TokenKey{TokenString, ordinalKey, TokenKeyword, inKey, TokenFloat, dotKey, TokenInteger, minusKey}, streamKeys(stream))
+		require.Equal(t, commentKey, stream.HeadToken().StringKey())
+		require.Equal(t, []string{"--> x\n", "1st", "index", "in", ".5", ".", "1", "-"},
+			streamValues(tokenizer.ParseString("--> x\n1st index in .5 . 1 -")))
+
+		// ties are resolved by priority
+		tokenizer = New().DefineTokens(ordinalKey, []string{"1"}).UseMaximalMunch()
+		require.Equal(t, []TokenKey{ordinalKey}, streamKeys(tokenizer.ParseString("1")))
+		tokenizer.SetPriority(CategoryNumber)
+		require.Equal(t, []TokenKey{TokenInteger}, streamKeys(tokenizer.ParseString("1")))
+		require.NotSame(t, &defaultCategories[0], &base().UseMaximalMunch().categories[0])
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		require.Len(t, base().Validate(), 4)
+		require.Empty(t, base().UseMaximalMunch().Validate())
+		require.Len(t, base().SetPriority(CategoryNumber, CategoryKeyword, CategoryString).Validate(), 0)
+	})
+}
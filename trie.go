@@ -0,0 +1,79 @@
+package tokenizer
+
+// trieNode is a node of the prefix tree of user defined tokens.
+type trieNode struct {
+	// token which ends on this node
+	ref *tokenRef
+	// bytes of the edges to children, sorted
+	labels []byte
+	// children in the order of labels
+	children []*trieNode
+}
+
+// child returns the child node by the edge byte or nil.
+func (n *trieNode) child(b byte) *trieNode {
+	if len(n.labels) <= 8 {
+		for i, l := range n.labels {
+			if l == b {
+				return n.children[i]
+			}
+		}
+		return nil
+	}
+	lo, hi := 0, len(n.labels)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if n.labels[m] < b {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	if lo < len(n.labels) && n.labels[lo] == b {
+		return n.children[lo]
+	}
+	return nil
+}
+
+// addChild adds new child node keeping labels sorted.
+func (n *trieNode) addChild(b byte) *trieNode {
+	i := 0
+	for i < len(n.labels) && n.labels[i] < b {
+		i++
+	}
+	c := &trieNode{}
+	n.labels = append(n.labels, 0)
+	copy(n.labels[i+1:], n.labels[i:])
+	n.labels[i] = b
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = c
+	return c
+}
+
+// tokenTrie is a prefix tree of user defined tokens.
+// The tree allows to find the longest token in a single pass.
+type tokenTrie struct {
+	// first level is a table by the first byte of tokens
+	root [256]*trieNode
+}
+
+// insert adds the token to the tree.
+// If the same token already exists the first defined token wins.
+func (tr *tokenTrie) insert(ref *tokenRef) {
+	node := tr.root[ref.Token[0]]
+	if node == nil {
+		node = &trieNode{}
+		tr.root[ref.Token[0]] = node
+	}
+	for _, b := range ref.Token[1:] {
+		next := node.child(b)
+		if next == nil {
+			next = node.addChild(b)
+		}
+		node = next
+	}
+	if node.ref == nil {
+		node.ref = ref
+	}
+}